@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// ackReaction acknowledges with a reaction to the trigger comment, which is less noisy than a comment.
+	ackReaction = "reaction"
+	ackComment  = "comment"
+	ackMsg      = "On it — attempting to merge..."
+)
+
+// acknowledge tells that merger started, by a 👍 reaction to the trigger comment or by a comment.
+// the reaction falls back to a comment if the id of the trigger comment is not given.
+func (gh *ghClient) acknowledge(ctx context.Context, e env) error {
+	if e.AckStyle == ackComment || e.CommentID == 0 {
+		return gh.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, ackMsg)
+	}
+	var err error
+	if e.CommentSource == commentSourceReview {
+		_, _, err = gh.client.Reactions.CreatePullRequestCommentReaction(ctx, e.Owner, e.Repo, e.CommentID, "+1")
+	} else {
+		_, _, err = gh.client.Reactions.CreateIssueCommentReaction(ctx, e.Owner, e.Repo, e.CommentID, "+1")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_ghClient_acknowledge(t *testing.T) {
+	tests := []struct {
+		name     string
+		e        env
+		wantPath string
+		wantBody string
+	}{
+		{
+			name:     "reaction to issue comment",
+			e:        env{AckStyle: ackReaction, CommentID: 10, CommentSource: commentSourceIssue},
+			wantPath: "/repos/abema/github-actions-merger/issues/comments/10/reactions",
+			wantBody: "+1",
+		},
+		{
+			name:     "reaction to review comment",
+			e:        env{AckStyle: ackReaction, CommentID: 10, CommentSource: commentSourceReview},
+			wantPath: "/repos/abema/github-actions-merger/pulls/comments/10/reactions",
+			wantBody: "+1",
+		},
+		{
+			name:     "comment",
+			e:        env{AckStyle: ackComment, CommentID: 10},
+			wantPath: "/repos/abema/github-actions-merger/issues/1/comments",
+			wantBody: ackMsg,
+		},
+		{
+			name:     "reaction without comment id",
+			e:        env{AckStyle: ackReaction},
+			wantPath: "/repos/abema/github-actions-merger/issues/1/comments",
+			wantBody: ackMsg,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotBody string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				var body struct {
+					Content string `json:"content"`
+					github.IssueComment
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				gotPath, gotBody = r.URL.Path, body.Content+body.GetBody()
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id":1}`))
+			}))
+			e := tt.e
+			e.Owner, e.Repo, e.PRNumber = "abema", "github-actions-merger", 1
+			if err := gh.acknowledge(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+			if gotPath != tt.wantPath || gotBody != tt.wantBody {
+				t.Errorf("acknowledge() requested %s %q, want %s %q", gotPath, gotBody, tt.wantPath, tt.wantBody)
+			}
+		})
+	}
+}
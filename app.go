@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appJWTLifetime is the lifetime of JWTs of the github app. github accepts at most 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// appTokenRefreshMargin is how long before the expiry installation tokens are refreshed,
+	// so that requests in flight are not sent with an expired token.
+	appTokenRefreshMargin = 5 * time.Minute
+)
+
+// tokenSource returns the source of installation tokens of the github app if app credentials are given,
+// otherwise the static GITHUB_TOKEN.
+func tokenSource(e env) (oauth2.TokenSource, error) {
+	if e.AppID == 0 && e.InstallationID == 0 && e.PrivateKey == "" {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: e.GithubToken}), nil
+	}
+	if e.AppID == 0 || e.InstallationID == 0 || e.PrivateKey == "" {
+		return nil, errors.New("app_id, installation_id and private_key are all required to authenticate as github app")
+	}
+	s, err := newAppTokenSource(e.AppID, e.InstallationID, e.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	// tokens are cached until they are about to expire.
+	return oauth2.ReuseTokenSource(nil, s), nil
+}
+
+// appTokenSource mints installation tokens of the github app.
+type appTokenSource struct {
+	client         *github.Client
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	now            func() time.Time
+}
+
+func newAppTokenSource(appID, installationID int64, privateKey string) (*appTokenSource, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &appTokenSource{
+		client:         github.NewClient(nil),
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		now:            time.Now,
+	}, nil
+}
+
+// parsePrivateKey parses PEM encoded RSA private key of the github app in PKCS#1 or PKCS#8.
+func parsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+// Token implements oauth2.TokenSource.
+// GitHub API docs: https://docs.github.com/en/rest/apps/apps#create-an-installation-access-token-for-an-app
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+	// go-github v17 uses the deprecated endpoint which is removed from github.
+	req, err := s.client.NewRequest(http.MethodPost, fmt.Sprintf("app/installations/%d/access_tokens", s.installationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	var t github.InstallationToken
+	if _, err := s.client.Do(context.Background(), req, &t); err != nil {
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: t.GetToken(),
+		Expiry:      t.GetExpiresAt().Add(-appTokenRefreshMargin),
+	}, nil
+}
+
+// jwt returns a JWT of the github app signed with RS256.
+func (s *appTokenSource) jwt() (string, error) {
+	now := s.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		// issued in the past to allow clock drift.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign jwt: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
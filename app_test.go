@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tokenSource(t *testing.T) {
+	key := testPrivateKey(t)
+	tests := []struct {
+		name    string
+		e       env
+		wantErr bool
+	}{
+		{
+			name: "github token",
+			e:    env{GithubToken: "token"},
+		},
+		{
+			name: "app",
+			e:    env{AppID: 1, InstallationID: 2, PrivateKey: encodePKCS1(key)},
+		},
+		{
+			name:    "missing installation id",
+			e:       env{AppID: 1, PrivateKey: encodePKCS1(key)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid private key",
+			e:       env{AppID: 1, InstallationID: 2, PrivateKey: "key"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tokenSource(tt.e)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tokenSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_parsePrivateKey(t *testing.T) {
+	key := testPrivateKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]string{
+		"pkcs1": encodePKCS1(key),
+		"pkcs8": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+	} {
+		got, err := parsePrivateKey(s)
+		if err != nil {
+			t.Errorf("parsePrivateKey(%s) error = %v", name, err)
+			continue
+		}
+		if !got.Equal(key) {
+			t.Errorf("parsePrivateKey(%s) returned a different key", name)
+		}
+	}
+}
+
+func Test_appTokenSource_Token(t *testing.T) {
+	key := testPrivateKey(t)
+	now := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/2/access_tokens" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			t.Errorf("jwt = %q", jwt)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			t.Errorf("jwt signature is invalid: %v", err)
+		}
+		var claims struct {
+			Iat int64  `json:"iat"`
+			Exp int64  `json:"exp"`
+			Iss string `json:"iss"`
+		}
+		b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		json.Unmarshal(b, &claims)
+		if claims.Iss != "1" || claims.Iat != now.Add(-time.Minute).Unix() || claims.Exp != now.Add(appJWTLifetime).Unix() {
+			t.Errorf("jwt claims = %+v", claims)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":"ghs_installation","expires_at":"2023-01-02T13:00:00Z"}`))
+	}))
+	defer srv.Close()
+	s, err := newAppTokenSource(1, 2, encodePKCS1(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.client.BaseURL, _ = url.Parse(srv.URL + "/")
+	s.now = func() time.Time { return now }
+	got, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "ghs_installation" {
+		t.Errorf("Token() access token = %v, want ghs_installation", got.AccessToken)
+	}
+	// refreshed before the expiry.
+	if want := time.Date(2023, 1, 2, 12, 55, 0, 0, time.UTC); !got.Expiry.Equal(want) {
+		t.Errorf("Token() expiry = %v, want %v", got.Expiry, want)
+	}
+}
+
+func testPrivateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encodePKCS1(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// teamPrefix is a prefix of mergers entry which specifies a team of the owner organization .e.g. team:core-reviewers
+// members are allowed only if the team has access to the repository.
+const teamPrefix = "team:"
+
+// orgTeamPrefix is a prefix of mergers entry which specifies a team of the owner organization, or of another organization
+// if it is qualified .e.g. org:platform or org:other-org/platform. members are allowed even if the team is not a collaborator of the repository.
+const orgTeamPrefix = "org:"
+
+// policies of EMPTY_MERGERS_POLICY, which decide who is allowed when no mergers are configured.
+const (
+	// emptyMergersAllow allows every actor who can comment, which is the default for backward compatibility.
+	emptyMergersAllow = "allow"
+	// emptyMergersDeny allows no one, to force mergers to be configured explicitly.
+	emptyMergersDeny = "deny"
+)
+
+// teamRef is a team of an organization specified in mergers.
+type teamRef struct {
+	org  string
+	slug string
+	// repoScoped is true for team: entries, whose team must have access to the repository.
+	repoScoped bool
+}
+
+// parseTeam returns the team of mergers entry prefixed with team: or org:. teams are of owner unless the org: entry names the organization.
+func parseTeam(m, owner string) (teamRef, bool) {
+	if slug, ok := strings.CutPrefix(m, teamPrefix); ok {
+		return teamRef{org: owner, slug: slug, repoScoped: true}, true
+	}
+	spec, ok := strings.CutPrefix(m, orgTeamPrefix)
+	if !ok {
+		return teamRef{}, false
+	}
+	if org, slug, ok := strings.Cut(spec, "/"); ok {
+		return teamRef{org: org, slug: slug}, true
+	}
+	return teamRef{org: owner, slug: spec}, true
+}
+
+// authorize returns error if actor is not allowed to merge.
+// every actor is allowed if mergers is empty, unless RequireWriteAccess is true or EmptyMergersPolicy is deny.
+func (gh *ghClient) authorize(ctx context.Context, e env) error {
+	owner, actor, mergers := e.Owner, e.Actor, e.Mergers
+	if len(mergers) == 0 {
+		if e.EmptyMergersPolicy == emptyMergersDeny {
+			return &unauthorizedError{actor: actor, noMergers: true}
+		}
+		if e.RequireWriteAccess {
+			return gh.checkWriteAccess(ctx, owner, e.Repo, actor)
+		}
+		return nil
+	}
+	var teams []teamRef
+	for _, m := range mergers {
+		if team, ok := parseTeam(m, owner); ok {
+			teams = append(teams, team)
+			continue
+		}
+		if actor == m {
+			// if actor matches specified mergers, then valid workflow run.
+			return nil
+		}
+	}
+	// resolve teams after usernames to avoid unnecessary api calls.
+	for _, team := range teams {
+		member, err := gh.isTeamMember(ctx, team.org, team.slug, actor)
+		if err != nil {
+			return err
+		}
+		if member && team.repoScoped {
+			if member, err = gh.teamHasRepo(ctx, team.org, team.slug, owner, e.Repo); err != nil {
+				return err
+			}
+		}
+		if member {
+			return nil
+		}
+	}
+	return &unauthorizedError{actor: actor, mergers: mergers}
+}
+
+// authorizeTarget returns error unless the actor may merge the pull request of another repository targeted by the comment.
+// the repository must be listed in TARGET_REPOS, and the actor needs write access to it in addition to authorize,
+// since mergers are configured for the repository of the workflow.
+func (gh *ghClient) authorizeTarget(ctx context.Context, e env, cmd *command) error {
+	t := cmd.target
+	if !isTargetRepo(e.TargetRepos, t.owner, t.repo) {
+		return withReason(reasonUnauthorized, fmt.Errorf("%s/%s is not listed in target repos", t.owner, t.repo))
+	}
+	// assignees of pull requests in other repositories are not trusted.
+	if cmd.unauthorized != nil {
+		return cmd.unauthorized
+	}
+	return gh.checkWriteAccess(ctx, t.owner, t.repo, e.Actor)
+}
+
+// isTargetRepo returns whether owner/repo is listed in repos. names are case insensitive as github.
+func isTargetRepo(repos []string, owner, repo string) bool {
+	for _, r := range repos {
+		if strings.EqualFold(strings.TrimSpace(r), owner+"/"+repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeAssignee returns unauthorized unless the actor is an assignee of the pull request.
+func (gh *ghClient) authorizeAssignee(ctx context.Context, e env, unauthorized error) error {
+	pr, _, err := gh.client.PullRequests.Get(ctx, e.Owner, e.Repo, e.PRNumber)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request: %w", err)
+	}
+	if isAssignee(pr, e.Actor) {
+		return nil
+	}
+	return unauthorized
+}
+
+// isAssignee returns whether user is assigned to the pull request.
+func isAssignee(pr *github.PullRequest, user string) bool {
+	for _, a := range pr.Assignees {
+		if a.GetLogin() == user {
+			return true
+		}
+	}
+	return false
+}
+
+// loadMergersFile returns mergers listed in the file at path of the repository.
+// the file is read from the default branch rather than the pull request, so that pull requests cannot add mergers by themselves.
+func (gh *ghClient) loadMergersFile(ctx context.Context, owner, repo, path string) ([]string, error) {
+	file, _, _, err := gh.client.Repositories.GetContents(ctx, owner, repo, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mergers file: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("mergers file %s is not a file", path)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mergers file: %w", err)
+	}
+	return parseMergers(content), nil
+}
+
+// parseMergers returns usernames and teams listed one per line. blank lines and # comments are ignored.
+func parseMergers(content string) []string {
+	var mergers []string
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			mergers = append(mergers, line)
+		}
+	}
+	return mergers
+}
+
+// unauthorizedError is an error when the actor is not allowed to merge.
+// mergers is empty when the actor lacks write access.
+type unauthorizedError struct {
+	actor   string
+	mergers []string
+	// assignees is true when assignees of the pull request are also allowed.
+	assignees bool
+	// noMergers is true when no one is allowed since mergers are not configured.
+	noMergers bool
+}
+
+func (e *unauthorizedError) Error() string {
+	if e.noMergers {
+		return fmt.Sprintf("actor %s is not allowed since no mergers are configured", e.actor)
+	}
+	if len(e.mergers) == 0 {
+		return fmt.Sprintf("actor %s lacks write access", e.actor)
+	}
+	return fmt.Sprintf("actor %s is not in mergers list", e.actor)
+}
+
+// message returns a message posted to the pull request.
+// only configured mergers entries are listed so that members of teams are not disclosed.
+func (e *unauthorizedError) message() string {
+	assignees := ""
+	if e.assignees {
+		assignees = " Assignees of this PR are also allowed."
+	}
+	if e.noMergers {
+		return fmt.Sprintf("@%s is not allowed to merge this PR since no mergers are configured.%s Please contact a maintainer.", e.actor, assignees)
+	}
+	if len(e.mergers) == 0 {
+		return fmt.Sprintf("@%s is not allowed to merge this PR since write access to the repository is required.%s Please contact a maintainer.", e.actor, assignees)
+	}
+	allowed := make([]string, 0, len(e.mergers))
+	for _, m := range e.mergers {
+		if team, ok := parseTeam(m, ""); ok {
+			name := team.slug
+			if team.org != "" {
+				name = team.org + "/" + team.slug
+			}
+			allowed = append(allowed, fmt.Sprintf("members of team `%s`", name))
+		} else {
+			allowed = append(allowed, "@"+m)
+		}
+	}
+	return fmt.Sprintf("@%s is not allowed to merge this PR. Allowed mergers: %s.%s Please ask one of them to merge.", e.actor, strings.Join(allowed, ", "), assignees)
+}
+
+// isTeamMember returns whether user is an active member of the team in the org.
+func (gh *ghClient) isTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	key := org + "/" + team + "/" + user
+	if member, ok := gh.teamMembers[key]; ok {
+		return member, nil
+	}
+	// GitHub API docs: https://docs.github.com/en/rest/teams/members#get-team-membership-for-a-user
+	req, err := gh.client.NewRequest(http.MethodGet, fmt.Sprintf("orgs/%s/teams/%s/memberships/%s", org, team, user), nil)
+	if err != nil {
+		return false, err
+	}
+	m := new(github.Membership)
+	member := false
+	if _, err := gh.client.Do(ctx, req, m); err != nil {
+		if hasStatus(err, http.StatusForbidden) {
+			// tokens without read access to the organization cannot tell whether the user is a member.
+			return false, fmt.Errorf("failed to get membership of team %s: the token lacks permission to read members of organization %s: %w", team, org, err)
+		}
+		if !hasStatus(err, http.StatusNotFound) {
+			return false, fmt.Errorf("failed to get membership of team %s: %w", team, err)
+		}
+	} else {
+		member = m.GetState() == "active"
+	}
+	gh.teamMembers[key] = member
+	return member, nil
+}
+
+// teamHasRepo returns whether the team in the org has access to the repository.
+func (gh *ghClient) teamHasRepo(ctx context.Context, org, team, owner, repo string) (bool, error) {
+	key := org + "/" + team + "/" + owner + "/" + repo
+	if ok, cached := gh.teamRepos[key]; cached {
+		return ok, nil
+	}
+	// GitHub API docs: https://docs.github.com/en/rest/teams/teams#check-team-permissions-for-a-repository
+	req, err := gh.client.NewRequest(http.MethodGet, fmt.Sprintf("orgs/%s/teams/%s/repos/%s/%s", org, team, owner, repo), nil)
+	if err != nil {
+		return false, err
+	}
+	ok := true
+	if _, err := gh.client.Do(ctx, req, nil); err != nil {
+		if !hasStatus(err, http.StatusNotFound) {
+			return false, fmt.Errorf("failed to get access of team %s to %s/%s: %w", team, owner, repo, err)
+		}
+		ok = false
+	}
+	gh.teamRepos[key] = ok
+	return ok, nil
+}
+
+// checkWriteAccess returns error if user does not have write permission of the repository.
+func (gh *ghClient) checkWriteAccess(ctx context.Context, owner, repo, user string) error {
+	p, _, err := gh.client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		return fmt.Errorf("failed to get permission of %s: %w", user, err)
+	}
+	switch p.GetPermission() {
+	case "admin", "write":
+		return nil
+	default:
+		return &unauthorizedError{actor: user}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ghClient_authorize(t *testing.T) {
+	type args struct {
+		actor   string
+		mergers []string
+		policy  string
+	}
+	tests := []struct {
+		name        string
+		teamMembers map[string]bool
+		teamRepos   map[string]bool
+		args        args
+		wantErr     bool
+	}{
+		{
+			name: "every actor is allowed without mergers",
+			args: args{actor: "github"},
+		},
+		{
+			name: "every actor is allowed without mergers by allow policy",
+			args: args{actor: "github", policy: emptyMergersAllow},
+		},
+		{
+			name:    "no actor is allowed without mergers by deny policy",
+			args:    args{actor: "github", policy: emptyMergersDeny},
+			wantErr: true,
+		},
+		{
+			name: "merger is allowed by deny policy",
+			args: args{actor: "0daryo", mergers: []string{"0daryo"}, policy: emptyMergersDeny},
+		},
+		{
+			name: "actor is merger",
+			args: args{actor: "0daryo", mergers: []string{"0daryo"}},
+		},
+		{
+			name:    "actor is not merger",
+			args:    args{actor: "github", mergers: []string{"0daryo"}},
+			wantErr: true,
+		},
+		{
+			name:        "actor is team member",
+			teamMembers: map[string]bool{"abema/core-reviewers/github": true},
+			teamRepos:   map[string]bool{"abema/core-reviewers/abema/github-actions-merger": true},
+			args:        args{actor: "github", mergers: []string{"0daryo", "team:core-reviewers"}},
+		},
+		{
+			name:        "actor is member of team without access to the repository",
+			teamMembers: map[string]bool{"abema/core-reviewers/github": true},
+			teamRepos:   map[string]bool{"abema/core-reviewers/abema/github-actions-merger": false},
+			args:        args{actor: "github", mergers: []string{"team:core-reviewers"}},
+			wantErr:     true,
+		},
+		{
+			name:        "actor is org team member without access to the repository",
+			teamMembers: map[string]bool{"abema/core-reviewers/github": true},
+			teamRepos:   map[string]bool{"abema/core-reviewers/abema/github-actions-merger": false},
+			args:        args{actor: "github", mergers: []string{"org:core-reviewers"}},
+		},
+		{
+			name:        "actor is not team member",
+			teamMembers: map[string]bool{"abema/core-reviewers/github": false},
+			args:        args{actor: "github", mergers: []string{"team:core-reviewers"}},
+			wantErr:     true,
+		},
+		{
+			name:        "actor is org team member",
+			teamMembers: map[string]bool{"abema/platform/github": true},
+			args:        args{actor: "github", mergers: []string{"org:platform"}},
+		},
+		{
+			name:        "actor is team member of another org",
+			teamMembers: map[string]bool{"other-org/platform/github": true},
+			args:        args{actor: "github", mergers: []string{"org:other-org/platform"}},
+		},
+		{
+			name:        "actor is member of the team in another org only",
+			teamMembers: map[string]bool{"abema/platform/github": false, "other-org/platform/github": true},
+			args:        args{actor: "github", mergers: []string{"org:platform"}},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// team memberships are resolved from the cache, so no api call is made.
+			gh := &ghClient{teamMembers: tt.teamMembers, teamRepos: tt.teamRepos}
+			e := env{Owner: "abema", Repo: "github-actions-merger", Actor: tt.args.actor, Mergers: tt.args.mergers, EmptyMergersPolicy: tt.args.policy}
+			if err := gh.authorize(context.Background(), e); (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ghClient_authorize_requireWriteAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission string
+		wantErr    bool
+	}{
+		{
+			name:       "admin",
+			permission: "admin",
+		},
+		{
+			name:       "write",
+			permission: "write",
+		},
+		{
+			name:       "read",
+			permission: "read",
+			wantErr:    true,
+		},
+		{
+			name:       "none",
+			permission: "none",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/abema/github-actions-merger/collaborators/github/permission" {
+					t.Errorf("request path = %s", r.URL.Path)
+				}
+				w.Write([]byte(`{"permission":"` + tt.permission + `"}`))
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", Actor: "github", RequireWriteAccess: true}
+			if err := gh.authorize(context.Background(), e); (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ghClient_authorizeTarget(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       *prTarget
+		permission   string
+		unauthorized *unauthorizedError
+		wantErr      string
+	}{
+		{
+			name:       "listed repository with write access",
+			target:     &prTarget{owner: "Abema", repo: "other-repo", number: 1},
+			permission: "write",
+		},
+		{
+			name:    "unlisted repository",
+			target:  &prTarget{owner: "abema", repo: "secret-repo", number: 1},
+			wantErr: "abema/secret-repo is not listed in target repos",
+		},
+		{
+			name:       "listed repository without write access",
+			target:     &prTarget{owner: "abema", repo: "other-repo", number: 1},
+			permission: "read",
+			wantErr:    "actor github lacks write access",
+		},
+		{
+			name:         "assignees are not allowed across repositories",
+			target:       &prTarget{owner: "abema", repo: "other-repo", number: 1},
+			unauthorized: &unauthorizedError{actor: "github", mergers: []string{"0daryo"}, assignees: true},
+			wantErr:      "actor github is not in mergers list",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.EqualFold(r.URL.Path, "/repos/abema/other-repo/collaborators/github/permission") {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				w.Write([]byte(`{"permission":"` + tt.permission + `"}`))
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", Actor: "github", TargetRepos: []string{"abema/other-repo"}}
+			err := gh.authorizeTarget(context.Background(), e, &command{target: tt.target, unauthorized: tt.unauthorized})
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("ghClient.authorizeTarget() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ghClient_authorize_teams(t *testing.T) {
+	tests := []struct {
+		name     string
+		mergers  []string
+		requests map[string]int
+		wantErr  bool
+	}{
+		{
+			name:    "team of the owner organization with access to the repository",
+			mergers: []string{"team:core-reviewers"},
+			requests: map[string]int{
+				"/orgs/abema/teams/core-reviewers/memberships/github":                http.StatusOK,
+				"/orgs/abema/teams/core-reviewers/repos/abema/github-actions-merger": http.StatusNoContent,
+			},
+		},
+		{
+			name:    "team of the owner organization without access to the repository",
+			mergers: []string{"team:core-reviewers"},
+			requests: map[string]int{
+				"/orgs/abema/teams/core-reviewers/memberships/github":                http.StatusOK,
+				"/orgs/abema/teams/core-reviewers/repos/abema/github-actions-merger": http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "team of another organization",
+			mergers: []string{"org:other-org/platform"},
+			requests: map[string]int{
+				"/orgs/other-org/teams/platform/memberships/github": http.StatusOK,
+			},
+		},
+		{
+			name:    "not member of the team of another organization",
+			mergers: []string{"org:other-org/platform"},
+			requests: map[string]int{
+				"/orgs/other-org/teams/platform/memberships/github": http.StatusNotFound,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status, ok := tt.requests[r.URL.Path]
+				if !ok {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					status = http.StatusNotFound
+				}
+				w.WriteHeader(status)
+				switch status {
+				case http.StatusOK:
+					w.Write([]byte(`{"state":"active"}`))
+				case http.StatusNotFound:
+					w.Write([]byte(`{"message":"Not Found"}`))
+				}
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", Actor: "github", Mergers: tt.mergers}
+			if err := gh.authorize(context.Background(), e); (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ghClient_isTeamMember(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		resp    string
+		want    bool
+		wantErr string
+	}{
+		{
+			name:   "active member",
+			status: http.StatusOK,
+			resp:   `{"state":"active"}`,
+			want:   true,
+		},
+		{
+			name:   "pending member",
+			status: http.StatusOK,
+			resp:   `{"state":"pending"}`,
+		},
+		{
+			name:   "not member",
+			status: http.StatusNotFound,
+			resp:   `{"message":"Not Found"}`,
+		},
+		{
+			name:    "token lacks org read permission",
+			status:  http.StatusForbidden,
+			resp:    `{"message":"Resource not accessible by integration"}`,
+			wantErr: "the token lacks permission to read members of organization other-org",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/orgs/other-org/teams/platform/memberships/github" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.resp))
+			}))
+			got, err := gh.isTeamMember(context.Background(), "other-org", "platform", "github")
+			if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ghClient.isTeamMember() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.isTeamMember() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_authorizeAssignee(t *testing.T) {
+	tests := []struct {
+		name    string
+		actor   string
+		wantErr bool
+	}{
+		{
+			name:  "assignee",
+			actor: "0daryo",
+		},
+		{
+			name:    "not assignee",
+			actor:   "github",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/abema/github-actions-merger/pulls/1" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				w.Write([]byte(`{"number":1,"assignees":[{"login":"na-ga"},{"login":"0daryo"}]}`))
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, Actor: tt.actor}
+			unauthorized := &unauthorizedError{actor: tt.actor, mergers: []string{"na-ga"}, assignees: true}
+			err := gh.authorizeAssignee(context.Background(), e, unauthorized)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.authorizeAssignee() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && err != unauthorized {
+				t.Errorf("ghClient.authorizeAssignee() error = %v, want %v", err, unauthorized)
+			}
+		})
+	}
+}
+
+func Test_ghClient_loadMergersFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "mergers listed",
+			status: http.StatusOK,
+			// base64 of "# maintainers\n0daryo\n\nna-ga # lead\nteam:core-reviewers\n"
+			body: `{"type":"file","encoding":"base64","content":"IyBtYWludGFpbmVycwowZGFyeW8KCm5hLWdhICMgbGVhZAp0ZWFtOmNvcmUtcmV2aWV3ZXJzCg=="}`,
+			want: []string{"0daryo", "na-ga", "team:core-reviewers"},
+		},
+		{
+			name:    "not found",
+			status:  http.StatusNotFound,
+			body:    `{"message":"Not Found"}`,
+			wantErr: true,
+		},
+		{
+			name:    "directory",
+			status:  http.StatusOK,
+			body:    `[{"type":"file","name":"MERGERS"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/abema/github-actions-merger/contents/.github/MERGERS" {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				if ref := r.URL.Query().Get("ref"); ref != "" {
+					t.Errorf("ref = %s, want the default branch", ref)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			got, err := gh.loadMergersFile(context.Background(), "abema", "github-actions-merger", ".github/MERGERS")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.loadMergersFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.loadMergersFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
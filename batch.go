@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// batchResult is a result of merging one of pull requests listed in the comment.
+type batchResult struct {
+	prNumber int
+	result   *mergeResult
+	err      error
+}
+
+// mergeBatch merges the pull requests listed in the comment in order.
+// failure of a pull request does not stop merging the rest, so that every result is reported at once.
+func (gh *ghClient) mergeBatch(ctx context.Context, e env, cmd *command, tpls *templates) []batchResult {
+	results := make([]batchResult, 0, len(cmd.prNumbers))
+	for _, n := range cmd.prNumbers {
+		pe := e
+		pe.PRNumber = n
+		r, err := gh.merge(ctx, pe, cmd, tpls)
+		if err != nil {
+			logger.Warnf("failed to merge PR #%d: %v", n, err)
+		}
+		results = append(results, batchResult{prNumber: n, result: r, err: err})
+	}
+	return results
+}
+
+// batchSummary returns markdown message of the results, and whether every pull request succeeded.
+// trigger is the comment suggested to retry failures.
+func batchSummary(results []batchResult, trigger string) (string, bool) {
+	failed := 0
+	sections := make([]string, 0, len(results))
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			failed++
+			sections = append(sections, fmt.Sprintf("Failed to merge PR #%d: %s\n", r.prNumber, errMsg(r.err, trigger)))
+		case r.result.duplicate:
+			sections = append(sections, fmt.Sprintf("PR #%d was already handled.\n", r.prNumber))
+		default:
+			sections = append(sections, mergeSummary(r.prNumber, r.result))
+		}
+	}
+	header := fmt.Sprintf("Handled %d of %d PRs successfully.\n", len(results)-failed, len(results))
+	return header + "\n" + strings.Join(sections, "\n"), failed == 0
+}
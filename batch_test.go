@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func Test_ghClient_mergeBatch(t *testing.T) {
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/abema/github-actions-merger/pulls/12":
+			w.Write([]byte(`{"number":12,"title":"first","merged":true,"merge_commit_sha":"abc123","merged_by":{"login":"octocat"}}`))
+		case "/repos/abema/github-actions-merger/pulls/15":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+		case "/repos/abema/github-actions-merger/pulls/18":
+			w.Write([]byte(`{"number":18,"title":"third","merged":true,"merge_commit_sha":"def456","merged_by":{"login":"octocat"}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}
+	got := gh.mergeBatch(context.Background(), e, &command{mergeMethod: "merge", prNumbers: []int{12, 15, 18}}, &templates{body: bodyTpl, subject: subjectTpl})
+	if len(got) != 3 {
+		t.Fatalf("ghClient.mergeBatch() returned %d results, want 3", len(got))
+	}
+	for i, want := range []struct {
+		prNumber int
+		sha      string
+		wantErr  bool
+	}{
+		{prNumber: 12, sha: "abc123"},
+		{prNumber: 15, wantErr: true},
+		{prNumber: 18, sha: "def456"},
+	} {
+		r := got[i]
+		if r.prNumber != want.prNumber || (r.err != nil) != want.wantErr {
+			t.Errorf("ghClient.mergeBatch()[%d] = PR #%d error %v, want PR #%d wantErr %v", i, r.prNumber, r.err, want.prNumber, want.wantErr)
+		}
+		if !want.wantErr && r.result.sha != want.sha {
+			t.Errorf("ghClient.mergeBatch()[%d] sha = %s, want %s", i, r.result.sha, want.sha)
+		}
+	}
+}
+
+func Test_batchSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []batchResult
+		want    string
+		wantOK  bool
+	}{
+		{
+			name: "all succeeded",
+			results: []batchResult{
+				{prNumber: 12, result: &mergeResult{mergeMethod: "merge", sha: "abc123", branchDeleted: true}},
+				{prNumber: 15, result: &mergeResult{duplicate: true}},
+			},
+			want: "Handled 2 of 2 PRs successfully.\n\n" +
+				"Merged PR #12 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: abc123\n" +
+				"- Head branch: deleted\n" +
+				"\n" +
+				"PR #15 was already handled.\n",
+			wantOK: true,
+		},
+		{
+			name: "partially failed",
+			results: []batchResult{
+				{prNumber: 12, err: errors.New("missing required labels: lgtm")},
+				{prNumber: 15, result: &mergeResult{mergeMethod: "squash", queued: true}},
+			},
+			want: "Handled 1 of 2 PRs successfully.\n\n" +
+				"Failed to merge PR #12: missing required labels: lgtm\n" +
+				"\n" +
+				"Queued PR #15 to merge automatically once requirements are met.\n\n" +
+				"- Merge method: `squash`\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := batchSummary(tt.results, "/merge")
+			if got != tt.want {
+				t.Errorf("batchSummary() = %q, want %q", got, tt.want)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("batchSummary() ok = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
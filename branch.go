@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// headUpdateTimeout is how long to wait for the head of the pull request to reflect the branch update.
+	headUpdateTimeout  = 60 * time.Second
+	headUpdateInterval = 2 * time.Second
+)
+
+var upToDateRegexp = regexp.MustCompile(`(?i)no new commits on the base branch`)
+
+// updateBranch merges the base branch into the head branch of the pull request.
+// it returns false without error if the branch is already up to date.
+// GitHub API docs: https://docs.github.com/en/rest/pulls/pulls#update-a-pull-request-branch
+func (gh *ghClient) updateBranch(ctx context.Context, owner, repo string, pr *github.PullRequest) (bool, error) {
+	req, err := gh.client.NewRequest(http.MethodPut, fmt.Sprintf("repos/%s/%s/pulls/%d/update-branch", owner, repo, pr.GetNumber()), map[string]string{
+		"expected_head_sha": pr.GetHead().GetSHA(),
+	})
+	if err != nil {
+		return false, err
+	}
+	_, err = gh.client.Do(ctx, req, nil)
+	// github responds 202 Accepted since the branch is updated asynchronously.
+	var aerr *github.AcceptedError
+	if err == nil || errors.As(err, &aerr) {
+		return true, nil
+	}
+	if hasStatus(err, http.StatusUnprocessableEntity) && upToDateRegexp.MatchString(err.Error()) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to update branch: %w", err)
+}
+
+// behindBy returns how many commits the head of the pull request is behind the tip of the base branch.
+func (gh *ghClient) behindBy(ctx context.Context, owner, repo string, pr *github.PullRequest) (int, error) {
+	// the head sha is compared instead of the branch, since branches of forks are not in the base repository.
+	c, _, err := gh.client.Repositories.CompareCommits(ctx, owner, repo, pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+	if err != nil {
+		return 0, fmt.Errorf("failed to compare with the base branch: %w", err)
+	}
+	return c.GetBehindBy(), nil
+}
+
+// waitHeadUpdated polls the pull request until its head differs from the head of pr, and returns the latest pull request.
+// the latest pull request is returned as is if the head is not updated within headUpdateTimeout.
+func (gh *ghClient) waitHeadUpdated(ctx context.Context, owner, repo string, pr *github.PullRequest) (*github.PullRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, headUpdateTimeout)
+	defer cancel()
+	latest := pr
+	for latest.GetHead().GetSHA() == pr.GetHead().GetSHA() {
+		select {
+		case <-ctx.Done():
+			logger.Warnf("head of PR #%d was not updated within %s", pr.GetNumber(), headUpdateTimeout)
+			return latest, nil
+		case <-time.After(headUpdateInterval):
+		}
+		var err error
+		if latest, _, err = gh.client.PullRequests.Get(ctx, owner, repo, pr.GetNumber()); err != nil {
+			return nil, fmt.Errorf("failed to get pull request: %w", err)
+		}
+	}
+	return latest, nil
+}
+
+// autoUpdateAndWait updates the branch of the pull request with the base branch, waits for checks of the updated head and evaluates them.
+// the wait is reported by a progress comment.
+// checks of the previous head are evaluated if no check is reported for the updated head within grace,
+// e.g. pushes by GITHUB_TOKEN do not trigger workflows, unless strict refuses to merge the updated head without checks.
+func (gh *ghClient) autoUpdateAndWait(ctx context.Context, e env, pr *github.PullRequest, grace time.Duration, strict bool) (*github.PullRequest, error) {
+	owner, repo := e.Owner, e.Repo
+	updated, err := gh.updateBranch(ctx, owner, repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return pr, gh.checkStatus(ctx, owner, repo, pr)
+	}
+	msg := "Updated the branch with the base branch. Waiting for checks to complete."
+	p := gh.startProgress(ctx, e, pr.GetNumber(), msg)
+	latest, err := gh.waitHeadUpdated(ctx, owner, repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	started, err := gh.waitChecksStarted(ctx, owner, repo, latest.GetHead().GetSHA(), grace)
+	if err != nil {
+		return nil, err
+	}
+	var cerr error
+	switch {
+	case started:
+		cerr = gh.waitChecks(ctx, owner, repo, latest)
+	case strict:
+		cerr = withReason(reasonChecksPending, fmt.Errorf("no checks started for the updated head %s within %s", latest.GetHead().GetSHA(), grace))
+	default:
+		msg += fmt.Sprintf("\n\nNo checks started within %s; using checks of the previous head.", grace)
+		cerr = gh.checkStatus(ctx, owner, repo, pr)
+	}
+	if cerr != nil {
+		msg += fmt.Sprintf("\n\nChecks did not pass: %v", cerr)
+	} else {
+		msg += "\n\nChecks passed."
+	}
+	p.finish(ctx, msg, cerr)
+	return latest, cerr
+}
+
+// waitChecksStarted polls checks of ref until any check is reported, and returns false if none is reported within grace.
+func (gh *ghClient) waitChecksStarted(ctx context.Context, owner, repo, ref string, grace time.Duration) (bool, error) {
+	deadline := time.After(grace)
+	for {
+		states, err := gh.checkStates(ctx, owner, repo, ref)
+		if err != nil {
+			return false, err
+		}
+		if len(states) > 0 {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-deadline:
+			return false, nil
+		case <-time.After(checksInterval):
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_ghClient_updateBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:     "updated",
+			status:   http.StatusAccepted,
+			response: `{"message":"Updating pull request branch."}`,
+			want:     true,
+		},
+		{
+			name:     "already up to date",
+			status:   http.StatusUnprocessableEntity,
+			response: `{"message":"There are no new commits on the base branch."}`,
+		},
+		{
+			name:     "head moved",
+			status:   http.StatusUnprocessableEntity,
+			response: `{"message":"expected head sha didn't match current head ref."}`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut || r.URL.Path != "/repos/abema/github-actions-merger/pulls/1/update-branch" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			pr := &github.PullRequest{
+				Number: github.Int(1),
+				Head:   &github.PullRequestBranch{SHA: github.String("sha")},
+			}
+			got, err := gh.updateBranch(context.Background(), "abema", "github-actions-merger", pr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.updateBranch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.updateBranch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_behindBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     int
+		wantErr  bool
+	}{
+		{
+			name:     "behind",
+			status:   http.StatusOK,
+			response: `{"status":"diverged","ahead_by":2,"behind_by":3}`,
+			want:     3,
+		},
+		{
+			name:     "up to date",
+			status:   http.StatusOK,
+			response: `{"status":"ahead","ahead_by":2,"behind_by":0}`,
+		},
+		{
+			name:     "not found",
+			status:   http.StatusNotFound,
+			response: `{"message":"Not Found"}`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/repos/abema/github-actions-merger/compare/main...sha" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			pr := &github.PullRequest{
+				Number: github.Int(1),
+				Base:   &github.PullRequestBranch{Ref: github.String("main")},
+				Head:   &github.PullRequestBranch{SHA: github.String("sha")},
+			}
+			got, err := gh.behindBy(context.Background(), "abema", "github-actions-merger", pr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.behindBy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.behindBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_autoUpdateAndWait(t *testing.T) {
+	tests := []struct {
+		name         string
+		updateStatus int
+		newRuns      string
+		strict       bool
+		wantSHA      string
+		wantErr      bool
+		wantComments []string
+	}{
+		{
+			name:         "up to date",
+			updateStatus: http.StatusUnprocessableEntity,
+			wantSHA:      "old",
+		},
+		{
+			name:         "checks of updated head passed",
+			updateStatus: http.StatusAccepted,
+			newRuns:      `[{"name":"test","status":"completed","conclusion":"success"}]`,
+			wantSHA:      "new",
+			wantComments: []string{
+				"Updated the branch with the base branch. Waiting for checks to complete.",
+				"Updated the branch with the base branch. Waiting for checks to complete.\n\nChecks passed.",
+			},
+		},
+		{
+			name:         "checks of updated head failed",
+			updateStatus: http.StatusAccepted,
+			newRuns:      `[{"name":"test","status":"completed","conclusion":"failure"}]`,
+			wantErr:      true,
+			wantComments: []string{
+				"Updated the branch with the base branch. Waiting for checks to complete.",
+				"Updated the branch with the base branch. Waiting for checks to complete.\n\nChecks did not pass: required check test failed",
+			},
+		},
+		{
+			name:         "no checks started",
+			updateStatus: http.StatusAccepted,
+			newRuns:      `[]`,
+			wantSHA:      "new",
+			wantComments: []string{
+				"Updated the branch with the base branch. Waiting for checks to complete.",
+				"Updated the branch with the base branch. Waiting for checks to complete.\n\nNo checks started within 1ms; using checks of the previous head.\n\nChecks passed.",
+			},
+		},
+		{
+			name:         "no checks started in strict mode",
+			updateStatus: http.StatusAccepted,
+			newRuns:      `[]`,
+			strict:       true,
+			wantErr:      true,
+			wantComments: []string{
+				"Updated the branch with the base branch. Waiting for checks to complete.",
+				"Updated the branch with the base branch. Waiting for checks to complete.\n\nChecks did not pass: no checks started for the updated head new within 1ms",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var comments []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPut && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/update-branch":
+					w.WriteHeader(tt.updateStatus)
+					w.Write([]byte(`{"message":"There are no new commits on the base branch."}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+					w.Write([]byte(`{"number":1,"head":{"sha":"new"},"base":{"ref":"main"}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/branches/main/protection/required_status_checks/contexts":
+					w.Write([]byte(`["test"]`))
+				case r.Method == http.MethodGet && (r.URL.Path == "/repos/abema/github-actions-merger/commits/old/status" || r.URL.Path == "/repos/abema/github-actions-merger/commits/new/status"):
+					w.Write([]byte(`{"statuses":[]}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/old/check-runs":
+					w.Write([]byte(`{"check_runs":[{"name":"test","status":"completed","conclusion":"success"}]}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/new/check-runs":
+					w.Write([]byte(`{"check_runs":` + tt.newRuns + `}`))
+				case r.Method == http.MethodPost && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments",
+					r.Method == http.MethodPatch && r.URL.Path == "/repos/abema/github-actions-merger/issues/comments/10":
+					var c github.IssueComment
+					json.NewDecoder(r.Body).Decode(&c)
+					comments = append(comments, c.GetBody())
+					w.Write([]byte(`{"id":10}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			pr := &github.PullRequest{
+				Number: github.Int(1),
+				Head:   &github.PullRequestBranch{SHA: github.String("old")},
+				Base:   &github.PullRequestBranch{Ref: github.String("main")},
+			}
+			got, err := gh.autoUpdateAndWait(context.Background(), env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}, pr, time.Millisecond, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.autoUpdateAndWait() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.GetHead().GetSHA() != tt.wantSHA {
+				t.Errorf("ghClient.autoUpdateAndWait() head = %v, want %v", got.GetHead().GetSHA(), tt.wantSHA)
+			}
+			if !reflect.DeepEqual(comments, tt.wantComments) {
+				t.Errorf("comments = %q, want %q", comments, tt.wantComments)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// checksInterval is the interval of polling checks.
+const checksInterval = 10 * time.Second
+
+const (
+	checkSuccess = "success"
+	checkPending = "pending"
+	checkFailure = "failure"
+)
+
+// checkStatus returns error if any required check of the pull request head is not successful.
+func (gh *ghClient) checkStatus(ctx context.Context, owner, repo string, pr *github.PullRequest) error {
+	required, err := gh.requiredChecks(ctx, owner, repo, pr.GetBase().GetRef())
+	if err != nil {
+		return err
+	}
+	states, err := gh.checkStates(ctx, owner, repo, pr.GetHead().GetSHA())
+	if err != nil {
+		return err
+	}
+	return evaluateChecks(required, states)
+}
+
+// requiredChecks returns required status check names of the branch.
+// nil is returned when the branch is not protected, then every check is regarded as required.
+func (gh *ghClient) requiredChecks(ctx context.Context, owner, repo, branch string) ([]string, error) {
+	contexts, _, err := gh.client.Repositories.ListRequiredStatusChecksContexts(ctx, owner, repo, branch)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound, http.StatusForbidden) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get required status checks: %w", err)
+	}
+	return contexts, nil
+}
+
+// checkStates returns states of commit statuses and check runs of the ref keyed by their name.
+func (gh *ghClient) checkStates(ctx context.Context, owner, repo, ref string) (map[string]string, error) {
+	states := map[string]string{}
+	status, _, err := gh.client.Repositories.GetCombinedStatus(ctx, owner, repo, ref, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get combined status: %w", err)
+	}
+	for _, s := range status.Statuses {
+		states[s.GetContext()] = statusState(s.GetState())
+	}
+	opt := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, resp, err := gh.client.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list check runs: %w", err)
+		}
+		for _, r := range runs.CheckRuns {
+			states[r.GetName()] = checkRunState(r.GetStatus(), r.GetConclusion())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return states, nil
+}
+
+// statusState converts commit status state into check state.
+func statusState(state string) string {
+	switch state {
+	case "success":
+		return checkSuccess
+	case "pending":
+		return checkPending
+	default:
+		return checkFailure
+	}
+}
+
+// checkRunState converts check run status and conclusion into check state.
+func checkRunState(status, conclusion string) string {
+	if status != "completed" {
+		return checkPending
+	}
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return checkSuccess
+	default:
+		return checkFailure
+	}
+}
+
+// evaluateChecks returns error if any required check is not successful.
+// failures are reported before pending checks, so that waiting stops as soon as any required check concludes as failed.
+// required checks which are not reported yet are regarded as pending.
+// if required is empty, every reported check is regarded as required.
+func evaluateChecks(required []string, states map[string]string) error {
+	if len(required) == 0 {
+		for name := range states {
+			required = append(required, name)
+		}
+		sort.Strings(required)
+	}
+	var pending, failed []string
+	for _, name := range required {
+		switch states[name] {
+		case checkSuccess:
+		case checkFailure:
+			failed = append(failed, name)
+		default:
+			pending = append(pending, name)
+		}
+	}
+	switch len(failed) {
+	case 0:
+	case 1:
+		return withReason(reasonChecksFailed, fmt.Errorf("required check %s failed", failed[0]))
+	default:
+		return withReason(reasonChecksFailed, fmt.Errorf("required checks %s failed", strings.Join(failed, ", ")))
+	}
+	if len(pending) > 0 {
+		return &pendingChecksError{names: pending}
+	}
+	return nil
+}
+
+// pendingChecksError is an error when required checks are not completed yet.
+type pendingChecksError struct {
+	names []string
+}
+
+func (e *pendingChecksError) Error() string {
+	return fmt.Sprintf("%d required checks still pending: %s", len(e.names), strings.Join(e.names, ", "))
+}
+
+// waitChecks polls checks of the pull request head until no required check is pending.
+// the last error is returned if checks are still pending when ctx is done.
+func (gh *ghClient) waitChecks(ctx context.Context, owner, repo string, pr *github.PullRequest) error {
+	for {
+		err := gh.checkStatus(ctx, owner, repo, pr)
+		var perr *pendingChecksError
+		if !errors.As(err, &perr) {
+			return err
+		}
+		logger.Debugf("waiting for checks of PR #%d: %v", pr.GetNumber(), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(checksInterval):
+		}
+	}
+}
+
+// waitNamedCheck waits within timeout for the check of name on the pull request head to complete,
+// regardless of whether it is required by branch protection, and returns error unless it succeeded.
+// the wait is reported by a progress comment while the check is pending.
+func (gh *ghClient) waitNamedCheck(ctx context.Context, e env, pr *github.PullRequest, name string, timeout time.Duration) error {
+	owner, repo := e.Owner, e.Repo
+	state, err := gh.namedCheckState(ctx, owner, repo, pr.GetHead().GetSHA(), name)
+	if err != nil {
+		return err
+	}
+	var p *progress
+	msg := fmt.Sprintf("Waiting for check %s to complete.", name)
+	if state == checkPending {
+		p = gh.startProgress(ctx, e, pr.GetNumber(), msg)
+		if state, err = gh.pollNamedCheck(ctx, owner, repo, pr.GetHead().GetSHA(), name, timeout); err != nil {
+			return err
+		}
+	}
+	var cerr error
+	switch state {
+	case checkSuccess:
+	case checkFailure:
+		cerr = withReason(reasonChecksFailed, fmt.Errorf("required check %s failed", name))
+	default:
+		cerr = &pendingChecksError{names: []string{name}}
+	}
+	if p != nil {
+		if cerr != nil {
+			msg += fmt.Sprintf("\n\nCheck did not pass: %v", cerr)
+		} else {
+			msg += "\n\nCheck passed."
+		}
+		p.finish(ctx, msg, cerr)
+	}
+	return cerr
+}
+
+// namedCheckState returns the state of the check of name on ref. checks which are not reported yet are regarded as pending.
+func (gh *ghClient) namedCheckState(ctx context.Context, owner, repo, ref, name string) (string, error) {
+	states, err := gh.checkStates(ctx, owner, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := states[name]; ok {
+		return s, nil
+	}
+	return checkPending, nil
+}
+
+// pollNamedCheck polls the check of name on ref until it is not pending or timeout passes, and returns the last state.
+func (gh *ghClient) pollNamedCheck(ctx context.Context, owner, repo, ref, name string, timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return checkPending, nil
+		case <-deadline:
+			return checkPending, nil
+		case <-time.After(checksInterval):
+		}
+		state, err := gh.namedCheckState(ctx, owner, repo, ref, name)
+		if err != nil || state != checkPending {
+			return state, err
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_checkRunState(t *testing.T) {
+	type args struct {
+		status     string
+		conclusion string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "in progress",
+			args: args{status: "in_progress"},
+			want: checkPending,
+		},
+		{
+			name: "success",
+			args: args{status: "completed", conclusion: "success"},
+			want: checkSuccess,
+		},
+		{
+			name: "skipped",
+			args: args{status: "completed", conclusion: "skipped"},
+			want: checkSuccess,
+		},
+		{
+			name: "failure",
+			args: args{status: "completed", conclusion: "timed_out"},
+			want: checkFailure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkRunState(tt.args.status, tt.args.conclusion); got != tt.want {
+				t.Errorf("checkRunState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_evaluateChecks(t *testing.T) {
+	type args struct {
+		required []string
+		states   map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr string
+	}{
+		{
+			name: "all required checks passed",
+			args: args{
+				required: []string{"build", "test"},
+				states:   map[string]string{"build": checkSuccess, "test": checkSuccess, "lint": checkFailure},
+			},
+		},
+		{
+			name: "required checks pending",
+			args: args{
+				required: []string{"build", "test", "e2e"},
+				states:   map[string]string{"build": checkPending, "test": checkPending},
+			},
+			wantErr: "3 required checks still pending: build, test, e2e",
+		},
+		{
+			name: "required check failed",
+			args: args{
+				required: []string{"build", "test"},
+				states:   map[string]string{"build": checkFailure, "test": checkPending},
+			},
+			wantErr: "required check build failed",
+		},
+		{
+			name: "required checks failed",
+			args: args{
+				required: []string{"build", "test"},
+				states:   map[string]string{"build": checkFailure, "test": checkFailure},
+			},
+			wantErr: "required checks build, test failed",
+		},
+		{
+			name: "every check is required without branch protection",
+			args: args{
+				states: map[string]string{"build": checkSuccess, "lint": checkPending},
+			},
+			wantErr: "1 required checks still pending: lint",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := evaluateChecks(tt.args.required, tt.args.states)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("evaluateChecks() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("evaluateChecks() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ghClient_waitChecks(t *testing.T) {
+	polls := 0
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/branches/main/protection/required_status_checks/contexts":
+			w.Write([]byte(`["build","test"]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/sha/status":
+			w.Write([]byte(`{"statuses":[]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/sha/check-runs":
+			polls++
+			w.Write([]byte(`{"check_runs":[{"name":"build","status":"completed","conclusion":"failure"},{"name":"test","status":"queued"}]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+		Head:   &github.PullRequestBranch{SHA: github.String("sha")},
+	}
+	// the failed check is refused without waiting for the queued one.
+	err := gh.waitChecks(context.Background(), "abema", "github-actions-merger", pr)
+	if err == nil || err.Error() != "required check build failed" {
+		t.Errorf("ghClient.waitChecks() error = %v, want %q", err, "required check build failed")
+	}
+	if got := failureReason(err); got != reasonChecksFailed {
+		t.Errorf("failureReason() = %v, want %v", got, reasonChecksFailed)
+	}
+	if polls != 1 {
+		t.Errorf("checks polled %d times, want 1", polls)
+	}
+}
+
+func Test_ghClient_waitNamedCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		runs         string
+		wantErr      string
+		wantComments []string
+	}{
+		{
+			name: "succeeded",
+			runs: `[{"name":"integration-tests","status":"completed","conclusion":"success"},{"name":"lint","status":"completed","conclusion":"failure"}]`,
+		},
+		{
+			name:    "failed",
+			runs:    `[{"name":"integration-tests","status":"completed","conclusion":"failure"}]`,
+			wantErr: "required check integration-tests failed",
+		},
+		{
+			name:    "not completed within timeout",
+			runs:    `[{"name":"integration-tests","status":"in_progress"}]`,
+			wantErr: "1 required checks still pending: integration-tests",
+			wantComments: []string{
+				"Waiting for check integration-tests to complete.",
+				"Waiting for check integration-tests to complete.\n\nCheck did not pass: 1 required checks still pending: integration-tests",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var comments []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/sha/status":
+					w.Write([]byte(`{"statuses":[]}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/sha/check-runs":
+					w.Write([]byte(`{"check_runs":` + tt.runs + `}`))
+				case r.Method == http.MethodPost && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments",
+					r.Method == http.MethodPatch && r.URL.Path == "/repos/abema/github-actions-merger/issues/comments/10":
+					var c github.IssueComment
+					json.NewDecoder(r.Body).Decode(&c)
+					comments = append(comments, c.GetBody())
+					w.Write([]byte(`{"id":10}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			pr := &github.PullRequest{
+				Number: github.Int(1),
+				Head:   &github.PullRequestBranch{SHA: github.String("sha")},
+			}
+			err := gh.waitNamedCheck(context.Background(), env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}, pr, "integration-tests", time.Millisecond)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("ghClient.waitNamedCheck() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(comments, tt.wantComments) {
+				t.Errorf("comments = %q, want %q", comments, tt.wantComments)
+			}
+		})
+	}
+}
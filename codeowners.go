@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// codeOwnersPaths are locations of CODEOWNERS in the order github looks them up.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeOwnersRule is a line of CODEOWNERS.
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	// owners are @user, @org/team or email addresses in lower case. empty owners leave matching files unowned.
+	owners []string
+}
+
+// loadCodeOwners returns rules of CODEOWNERS of the branch. no rules are returned if the repository has no CODEOWNERS.
+func (gh *ghClient) loadCodeOwners(ctx context.Context, owner, repo, branch string) ([]codeOwnersRule, error) {
+	for _, path := range codeOwnersPaths {
+		file, _, _, err := gh.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: branch})
+		if err != nil {
+			if hasStatus(err, http.StatusNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get %s: %w", path, err)
+		}
+		if file == nil {
+			continue
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		return parseCodeOwners(content), nil
+	}
+	return nil, nil
+}
+
+// parseCodeOwners returns rules listed one per line. blank lines and # comments are ignored.
+func parseCodeOwners(content string) []codeOwnersRule {
+	var rules []codeOwnersRule
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		owners := make([]string, 0, len(fields)-1)
+		for _, o := range fields[1:] {
+			owners = append(owners, strings.ToLower(o))
+		}
+		rules = append(rules, codeOwnersRule{pattern: codeOwnersRegexp(fields[0]), owners: owners})
+	}
+	return rules
+}
+
+// codeOwnersRegexp converts pattern of CODEOWNERS into regexp matching paths, following gitignore like github.
+// patterns without `/` except a trailing one match at any depth, and patterns matching a directory match files under it,
+// except that `dir/*` matches only files directly in dir.
+func codeOwnersRegexp(pattern string) *regexp.Regexp {
+	prefix := "^"
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		prefix = "^(?:.*/)?"
+	}
+	p := strings.TrimPrefix(pattern, "/")
+	if rest, ok := strings.CutPrefix(p, "**/"); ok {
+		prefix, p = "^(?:.*/)?", rest
+	}
+	suffix := "(?:/.*)?$"
+	switch {
+	case strings.HasSuffix(p, "/"):
+		p, suffix = strings.TrimSuffix(p, "/"), "/.*$"
+	case strings.HasSuffix(p, "/*"):
+		suffix = "$"
+	}
+	return regexp.MustCompile(prefix + globPattern(p) + suffix)
+}
+
+// ownersOf returns owners of path, which are of the last matching rule.
+func ownersOf(rules []codeOwnersRule, path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.MatchString(path) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// codeOwners returns owners in CODEOWNERS of the base branch who own any file changed by the pull request.
+func (gh *ghClient) codeOwners(ctx context.Context, owner, repo string, pr *github.PullRequest) (map[string]bool, error) {
+	owners := map[string]bool{}
+	// github applies CODEOWNERS of the base branch, so that pull requests cannot change their own owners.
+	rules, err := gh.loadCodeOwners(ctx, owner, repo, pr.GetBase().GetRef())
+	if err != nil || len(rules) == 0 {
+		return owners, err
+	}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := gh.client.PullRequests.ListFiles(ctx, owner, repo, pr.GetNumber(), opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, f := range files {
+			for _, o := range ownersOf(rules, f.GetFilename()) {
+				owners[o] = true
+			}
+		}
+		if resp.NextPage == 0 {
+			return owners, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// isCodeOwner returns whether user is one of owners, directly or as a member of an owning team of org.
+func (gh *ghClient) isCodeOwner(ctx context.Context, org, user string, owners map[string]bool) (bool, error) {
+	if owners["@"+strings.ToLower(user)] {
+		return true, nil
+	}
+	for o := range owners {
+		team, ok := strings.CutPrefix(o, "@"+strings.ToLower(org)+"/")
+		if !ok {
+			continue
+		}
+		member, err := gh.isTeamMember(ctx, org, team, user)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
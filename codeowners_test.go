@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_codeOwnersRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "*", path: "sub/main.go", want: true},
+		{pattern: "*.go", path: "main.go", want: true},
+		{pattern: "*.go", path: "sub/main.go", want: true},
+		{pattern: "*.go", path: "main.gox", want: false},
+		{pattern: "/build/logs/", path: "build/logs/a/b.log", want: true},
+		{pattern: "/build/logs/", path: "sub/build/logs/b.log", want: false},
+		{pattern: "docs/*", path: "docs/usage.md", want: true},
+		{pattern: "docs/*", path: "docs/sub/usage.md", want: false},
+		{pattern: "apps/", path: "sub/apps/main.go", want: true},
+		{pattern: "apps/", path: "apps", want: false},
+		{pattern: "**/logs", path: "logs/a.log", want: true},
+		{pattern: "**/logs", path: "sub/logs/a.log", want: true},
+		{pattern: "/scripts", path: "scripts/build.sh", want: true},
+		{pattern: "/scripts", path: "scripts", want: true},
+		{pattern: "/scripts", path: "sub/scripts", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			if got := codeOwnersRegexp(tt.pattern).MatchString(tt.path); got != tt.want {
+				t.Errorf("codeOwnersRegexp(%q).MatchString(%q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ownersOf(t *testing.T) {
+	rules := parseCodeOwners("# default owners\n*       @Alice\n\n/docs/  @abema/Docs # docs team\n/docs/generated/\n")
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "main.go", want: []string{"@alice"}},
+		{path: "docs/usage.md", want: []string{"@abema/docs"}},
+		{path: "docs/generated/api.md", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ownersOf(rules, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ownersOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// maxPRCommits is the max number of commits of a pull request which github lists.
+const maxPRCommits = 250
+
+// commit is a commit of the pull request rendered in commit body.
+type commit struct {
+	SHA string
+	// Message is the first line of the commit message.
+	Message string
+	// Author is the git author of the commit .e.g. Alice <alice@example.com>, empty if the email is unknown.
+	Author string
+	// Login is the github user of the author, empty if the email is not linked to any user.
+	Login string
+}
+
+// listCommits returns at most max commits of the pull request in the order of the pull request.
+func (gh *ghClient) listCommits(ctx context.Context, owner, repo string, prNumber, max int) ([]commit, error) {
+	var commits []commit
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		cs, resp, err := gh.client.PullRequests.ListCommits(ctx, owner, repo, prNumber, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list commits: %w", err)
+		}
+		for _, c := range cs {
+			if len(commits) >= max {
+				logger.Debugf("commits of PR #%d are truncated to %d", prNumber, max)
+				return commits, nil
+			}
+			subject, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+			commits = append(commits, commit{SHA: c.GetSHA(), Message: subject, Author: gitIdentity(c.GetCommit().GetAuthor()), Login: c.GetAuthor().GetLogin()})
+		}
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// gitIdentity returns the identity of the git author in the form of trailers, or empty if the email is unknown.
+func gitIdentity(a *github.CommitAuthor) string {
+	if a.GetEmail() == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s <%s>", a.GetName(), a.GetEmail())
+}
+
+// coauthorTrailers returns Co-authored-by trailers of authors of commits in order of appearance without duplicates.
+// commits of the pull request author are skipped since the author is credited by the squash commit itself.
+func coauthorTrailers(commits []commit, prAuthor string) []string {
+	var trailers []string
+	seen := map[string]bool{}
+	for _, c := range commits {
+		if c.Author == "" || strings.EqualFold(c.Login, prAuthor) {
+			continue
+		}
+		// emails are case-insensitive in practice.
+		key := strings.ToLower(c.Author)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		trailers = append(trailers, "Co-authored-by: "+c.Author)
+	}
+	return trailers
+}
+
+// appendTrailers appends trailers to the commit message as the last paragraph. trailers already in msg are skipped.
+func appendTrailers(msg string, trailers []string) string {
+	var add []string
+	for _, t := range trailers {
+		if !strings.Contains(msg, t) {
+			add = append(add, t)
+		}
+	}
+	if len(add) == 0 {
+		return msg
+	}
+	if msg = strings.TrimRight(msg, "\n"); msg != "" {
+		msg += "\n\n"
+	}
+	return msg + strings.Join(add, "\n")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_ghClient_listCommits(t *testing.T) {
+	pages := map[string]string{
+		"":  `[{"sha":"a1","commit":{"message":"first\n\ndetails","author":{"name":"Alice","email":"alice@example.com"}},"author":{"login":"alice"}},{"sha":"b2","commit":{"message":"second"}}]`,
+		"2": `[{"sha":"c3","commit":{"message":"third"}}]`,
+	}
+	tests := []struct {
+		name string
+		max  int
+		want []commit
+	}{
+		{
+			name: "all pages",
+			max:  10,
+			want: []commit{{SHA: "a1", Message: "first", Author: "Alice <alice@example.com>", Login: "alice"}, {SHA: "b2", Message: "second"}, {SHA: "c3", Message: "third"}},
+		},
+		{
+			name: "truncated",
+			max:  1,
+			want: []commit{{SHA: "a1", Message: "first", Author: "Alice <alice@example.com>", Login: "alice"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+				}
+				w.Write([]byte(pages[page]))
+			}))
+			got, err := gh.listCommits(context.Background(), "abema", "github-actions-merger", 1, tt.max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.listCommits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_coauthorTrailers(t *testing.T) {
+	commits := []commit{
+		{SHA: "a1", Author: "Alice <alice@example.com>", Login: "alice"},
+		{SHA: "b2", Author: "Bob <bob@example.com>", Login: "bob"},
+		{SHA: "c3", Author: "Alice <alice@example.com>", Login: "alice"},
+		{SHA: "d4", Author: "Carol <carol@example.com>"},
+		{SHA: "e5", Author: "Bob <Bob@example.com>", Login: "bob"},
+		{SHA: "f6", Login: "dave"},
+	}
+	tests := []struct {
+		name     string
+		prAuthor string
+		want     []string
+	}{
+		{
+			name:     "skip the pull request author",
+			prAuthor: "Alice",
+			want:     []string{"Co-authored-by: Bob <bob@example.com>", "Co-authored-by: Carol <carol@example.com>"},
+		},
+		{
+			name:     "every author",
+			prAuthor: "erin",
+			want:     []string{"Co-authored-by: Alice <alice@example.com>", "Co-authored-by: Bob <bob@example.com>", "Co-authored-by: Carol <carol@example.com>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coauthorTrailers(commits, tt.prAuthor); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coauthorTrailers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendTrailers(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		trailers []string
+		want     string
+	}{
+		{
+			name:     "append as the last paragraph",
+			msg:      "description\n",
+			trailers: []string{"Co-authored-by: Bob <bob@example.com>", "Co-authored-by: Carol <carol@example.com>"},
+			want:     "description\n\nCo-authored-by: Bob <bob@example.com>\nCo-authored-by: Carol <carol@example.com>",
+		},
+		{
+			name:     "empty message",
+			trailers: []string{"Co-authored-by: Bob <bob@example.com>"},
+			want:     "Co-authored-by: Bob <bob@example.com>",
+		},
+		{
+			name:     "trailer already in the message",
+			msg:      "description\n\nCo-authored-by: Bob <bob@example.com>",
+			trailers: []string{"Co-authored-by: Bob <bob@example.com>"},
+			want:     "description\n\nCo-authored-by: Bob <bob@example.com>",
+		},
+		{
+			name: "no trailers",
+			msg:  "description\n",
+			want: "description\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appendTrailers(tt.msg, tt.trailers); got != tt.want {
+				t.Errorf("appendTrailers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// defaultConfigFile is the config file loaded from the repository if CONFIG_FILE is not specified.
+const defaultConfigFile = ".merger.yml"
+
+// bootstrapInputs are inputs used before the config file is loaded, so they must be inputs of the workflow.
+var bootstrapInputs = map[string]bool{
+	"GITHUB_TOKEN":        true,
+	"APP_ID":              true,
+	"INSTALLATION_ID":     true,
+	"PRIVATE_KEY":         true,
+	"OWNER":               true,
+	"REPO":                true,
+	"PR_NUMBER":           true,
+	"CONFIG_FILE":         true,
+	"MAX_RETRIES":         true,
+	"METRICS":             true,
+	"JOB_TIMEOUT_SECONDS": true,
+	"LOG_FORMAT":          true,
+	"LOG_LEVEL":           true,
+	"SELF_TEST":           true,
+	"RENDER_TEMPLATE":     true,
+	"DEBUG_PANIC":         true,
+}
+
+// configPath returns the path of the config file, and whether it is specified by CONFIG_FILE.
+func configPath() (string, bool) {
+	if path := os.Getenv("INPUT_CONFIG_FILE"); path != "" {
+		return path, true
+	}
+	return defaultConfigFile, false
+}
+
+// loadConfigFile sets inputs of the config file of the repository as environment variables unless they are already set,
+// so that inputs of the workflow take precedence over the config file.
+// the file is read from the default branch like MERGERS_FILE, since the workspace may be the head of the pull request,
+// whose author could otherwise grant themselves to merge.
+func (gh *ghClient) loadConfigFile(ctx context.Context, owner, repo string) error {
+	path, specified := configPath()
+	file, _, _, err := gh.client.Repositories.GetContents(ctx, owner, repo, path, nil)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) && !specified {
+			return nil
+		}
+		return fmt.Errorf("failed to get config file: %w", err)
+	}
+	if file == nil {
+		return fmt.Errorf("config file %s is not a file", path)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return fmt.Errorf("failed to decode config file: %w", err)
+	}
+	return loadConfig(path, strings.NewReader(content))
+}
+
+// loadWorkspaceConfigFile loads the config file from the workspace like loadConfigFile.
+// it is used only to render templates, which never merges.
+func loadWorkspaceConfigFile() error {
+	path, specified := configPath()
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !specified {
+			return nil
+		}
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+	return loadConfig(path, f)
+}
+
+// loadConfig parses the config file and applies it.
+func loadConfig(path string, r io.Reader) error {
+	values, err := parseConfig(r)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return applyConfig(values)
+}
+
+// applyConfig sets values as environment variables of inputs which are not set yet.
+func applyConfig(values map[string]string) error {
+	names := inputNames()
+	for key, value := range values {
+		name := strings.ToUpper(key)
+		if !names[name] {
+			return fmt.Errorf("unknown config key %s", key)
+		}
+		if bootstrapInputs[name] {
+			return fmt.Errorf("config key %s must be an input of the workflow", key)
+		}
+		if os.Getenv("INPUT_"+name) != "" {
+			continue
+		}
+		if err := os.Setenv("INPUT_"+name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputNames returns input names of env from envconfig tags.
+func inputNames() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(env{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("envconfig"); tag != "" {
+			names[tag] = true
+		}
+	}
+	return names
+}
+
+// parseConfig parses a flat yaml mapping of input names.
+// values are scalars, lists joined with commas, or literal blocks `|` for multi-line values.
+// other shapes of yaml are refused rather than read differently from yaml parsers.
+func parseConfig(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	var (
+		key   string // key waiting for a list or a literal block.
+		items []string
+		block []string
+		// literal is true while reading the literal block of key.
+		literal bool
+		indent  = -1
+	)
+	flush := func() {
+		switch {
+		case key == "":
+		case literal:
+			values[key] = strings.Join(block, "\n") + "\n"
+		default:
+			values[key] = strings.Join(items, ",")
+		}
+		key, items, block, literal, indent = "", nil, nil, false, -1
+	}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		if literal {
+			if trimmed == "" {
+				block = append(block, "")
+				continue
+			}
+			lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+			if indent < 0 {
+				indent = lineIndent
+			}
+			if lineIndent >= indent && indent > 0 {
+				block = append(block, line[indent:])
+				continue
+			}
+			// remove trailing blank lines of the block.
+			for len(block) > 0 && block[len(block)-1] == "" {
+				block = block[:len(block)-1]
+			}
+			flush()
+		}
+		trimmed = strings.TrimSpace(stripComment(line))
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if key == "" {
+				return nil, fmt.Errorf("line %d: list item without key", n)
+			}
+			items = append(items, unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))))
+			continue
+		}
+		flush()
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested mapping is not supported", n)
+		}
+		k, v, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		switch {
+		case v == "":
+			key = k
+		case v == "|":
+			key, literal = k, true
+		case strings.HasPrefix(v, "[") || strings.HasPrefix(v, "{"):
+			return nil, fmt.Errorf("line %d: flow collections are not supported, use a list of - items", n)
+		case v == ">" || strings.HasPrefix(v, "|") || strings.HasPrefix(v, ">"):
+			return nil, fmt.Errorf("line %d: only literal blocks | are supported", n)
+		case strings.HasPrefix(v, "&") || strings.HasPrefix(v, "*"):
+			return nil, fmt.Errorf("line %d: anchors and aliases are not supported", n)
+		default:
+			values[k] = unquote(v)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for len(block) > 0 && block[len(block)-1] == "" {
+		block = block[:len(block)-1]
+	}
+	flush()
+	return values, nil
+}
+
+// stripComment removes a comment starting with `#` outside of quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote removes single or double quotes around v.
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "scalars",
+			config: `# merger config
+merge_method: squash
+trigger_comment: '/ship'   # comment
+require_checks: true
+commit_subject_template: "{{ .Title }} #{{ .Number }}"
+`,
+			want: map[string]string{
+				"merge_method":            "squash",
+				"trigger_comment":         "/ship",
+				"require_checks":          "true",
+				"commit_subject_template": "{{ .Title }} #{{ .Number }}",
+			},
+		},
+		{
+			name: "list",
+			config: `mergers:
+  - alice
+  - team:platform
+block_labels:
+min_approvals: 1
+`,
+			want: map[string]string{
+				"mergers":       "alice,team:platform",
+				"block_labels":  "",
+				"min_approvals": "1",
+			},
+		},
+		{
+			name: "literal block",
+			config: `commit_body_template: |
+  {{ .Message }}
+
+  # Labels
+  {{ .Labels }}
+
+merge_method: rebase
+`,
+			want: map[string]string{
+				"commit_body_template": "{{ .Message }}\n\n# Labels\n{{ .Labels }}\n",
+				"merge_method":         "rebase",
+			},
+		},
+		{
+			name:    "nested mapping",
+			config:  "merge:\n  method: squash\n",
+			wantErr: true,
+		},
+		{
+			name:    "not a mapping",
+			config:  "squash\n",
+			wantErr: true,
+		},
+		{
+			name:    "list item without key",
+			config:  "- alice\n",
+			wantErr: true,
+		},
+		{
+			name:    "nested mapping after list",
+			config:  "mergers:\n  - alice\n  teams: platform\n",
+			wantErr: true,
+		},
+		{
+			name:    "indented by tab",
+			config:  "\tmerge_method: squash\n",
+			wantErr: true,
+		},
+		{
+			name:    "flow sequence",
+			config:  "mergers: [alice, bob]\n",
+			wantErr: true,
+		},
+		{
+			name:    "flow mapping",
+			config:  "command_map: {/ship: squash}\n",
+			wantErr: true,
+		},
+		{
+			name:    "folded block",
+			config:  "commit_body_template: >\n  {{ .Message }}\n",
+			wantErr: true,
+		},
+		{
+			name:    "literal block with chomping indicator",
+			config:  "commit_body_template: |-\n  {{ .Message }}\n",
+			wantErr: true,
+		},
+		{
+			name:    "alias",
+			config:  "merge_method: &method squash\n",
+			wantErr: true,
+		},
+		{
+			name:    "multiple documents",
+			config:  "merge_method: squash\n---\nmerge_method: rebase\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfig(strings.NewReader(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyConfig(t *testing.T) {
+	t.Setenv("INPUT_MERGE_METHOD", "rebase")
+	t.Setenv("INPUT_TRIGGER_COMMENT", "")
+	if err := applyConfig(map[string]string{
+		"merge_method":    "squash",
+		"trigger_comment": "/ship",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("INPUT_MERGE_METHOD"); got != "rebase" {
+		t.Errorf("INPUT_MERGE_METHOD = %v, want input to take precedence", got)
+	}
+	if got := os.Getenv("INPUT_TRIGGER_COMMENT"); got != "/ship" {
+		t.Errorf("INPUT_TRIGGER_COMMENT = %v, want /ship", got)
+	}
+	if err := applyConfig(map[string]string{"unknown_key": "value"}); err == nil {
+		t.Error("applyConfig() should fail with unknown key")
+	}
+	if err := applyConfig(map[string]string{"github_token": "token"}); err == nil {
+		t.Error("applyConfig() should fail with inputs used before loading the config file")
+	}
+}
+
+func Test_ghClient_loadConfigFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		status     int
+		body       string
+		wantPath   string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:     "default config file",
+			status:   http.StatusOK,
+			body:     `{"type":"file","encoding":"base64","content":"` + base64.StdEncoding.EncodeToString([]byte("mergers:\n  - alice\n")) + `"}`,
+			wantPath: "/repos/abema/github-actions-merger/contents/.merger.yml",
+			want:     "alice",
+		},
+		{
+			name:       "specified config file",
+			configFile: "config/merger.yml",
+			status:     http.StatusOK,
+			body:       `{"type":"file","encoding":"base64","content":"` + base64.StdEncoding.EncodeToString([]byte("mergers: bob\n")) + `"}`,
+			wantPath:   "/repos/abema/github-actions-merger/contents/config/merger.yml",
+			want:       "bob",
+		},
+		{
+			name:     "default config file does not exist",
+			status:   http.StatusNotFound,
+			body:     `{"message":"Not Found"}`,
+			wantPath: "/repos/abema/github-actions-merger/contents/.merger.yml",
+		},
+		{
+			name:       "specified config file does not exist",
+			configFile: "config/merger.yml",
+			status:     http.StatusNotFound,
+			body:       `{"message":"Not Found"}`,
+			wantPath:   "/repos/abema/github-actions-merger/contents/config/merger.yml",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INPUT_CONFIG_FILE", tt.configFile)
+			t.Setenv("INPUT_MERGERS", "")
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.wantPath {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				// the default branch is read rather than the head of the pull request.
+				if ref := r.URL.Query().Get("ref"); ref != "" {
+					t.Errorf("ref = %s, want the default branch", ref)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			err := gh.loadConfigFile(context.Background(), "abema", "github-actions-merger")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.loadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := os.Getenv("INPUT_MERGERS"); got != tt.want {
+				t.Errorf("INPUT_MERGERS = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
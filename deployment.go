@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// deploymentMargin is left before the job deadline when waiting for deployments,
+// so that the progress comment is updated and the refusal is posted before the job times out.
+const deploymentMargin = 30 * time.Second
+
+// deploymentNotFound is the status reported while the head has no deployment to the environment yet.
+const deploymentNotFound = "not deployed"
+
+// waitDeployment waits until the job deadline for the latest deployment of the pull request head to environment to succeed,
+// and returns error unless it succeeded.
+// the current deployment status is reported by a progress comment which is updated on changes.
+func (gh *ghClient) waitDeployment(ctx context.Context, e env, pr *github.PullRequest, environment string) error {
+	owner, repo, sha := e.Owner, e.Repo, pr.GetHead().GetSHA()
+	status, err := gh.deploymentStatus(ctx, owner, repo, sha, environment)
+	if err != nil {
+		return err
+	}
+	var p *progress
+	msgOf := func(status string) string {
+		return fmt.Sprintf("Waiting for deployment of %s to environment %s.\n\nCurrent deployment status: %s.", sha, environment, status)
+	}
+	if deploymentState(status) == checkPending {
+		p = gh.startProgress(ctx, e, pr.GetNumber(), msgOf(status))
+		timeout := defaultJobTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline) - deploymentMargin
+		}
+		if status, err = gh.pollDeployment(ctx, owner, repo, sha, environment, status, timeout, func(status string) {
+			p.update(ctx, msgOf(status))
+		}); err != nil {
+			return err
+		}
+	}
+	var derr error
+	switch deploymentState(status) {
+	case checkSuccess:
+	case checkFailure:
+		derr = withReason(reasonDeploymentFailed, fmt.Errorf("deployment to environment %s did not succeed: %s", environment, status))
+	default:
+		derr = withReason(reasonDeploymentPending, fmt.Errorf("deployment to environment %s is still %s", environment, status))
+	}
+	if p != nil {
+		msg := msgOf(status)
+		if derr != nil {
+			msg += fmt.Sprintf("\n\nDeployment did not pass: %v", derr)
+		} else {
+			msg += "\n\nDeployment succeeded."
+		}
+		p.finish(ctx, msg, derr)
+	}
+	return derr
+}
+
+// pollDeployment polls the deployment status of sha to env until it is not pending or timeout passes, and returns the last status.
+// changed is called when the status changes from last while pending.
+func (gh *ghClient) pollDeployment(ctx context.Context, owner, repo, sha, env, last string, timeout time.Duration, changed func(status string)) (string, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return last, nil
+		case <-deadline:
+			return last, nil
+		case <-time.After(checksInterval):
+		}
+		status, err := gh.deploymentStatus(ctx, owner, repo, sha, env)
+		if err != nil || deploymentState(status) != checkPending {
+			return status, err
+		}
+		if status != last {
+			changed(status)
+			last = status
+		}
+		logger.Debugf("waiting for deployment of %s to %s: %s", sha, env, status)
+	}
+}
+
+// deploymentStatus returns the status of the latest deployment of sha to env, or deploymentNotFound if it is not deployed yet.
+// inactive statuses are skipped, since github marks deployments inactive when they are superseded by later ones.
+func (gh *ghClient) deploymentStatus(ctx context.Context, owner, repo, sha, env string) (string, error) {
+	// deployments are listed from the newest.
+	deployments, _, err := gh.client.Repositories.ListDeployments(ctx, owner, repo, &github.DeploymentsListOptions{
+		SHA:         sha,
+		Environment: env,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list deployments: %w", err)
+	}
+	if len(deployments) == 0 {
+		return deploymentNotFound, nil
+	}
+	statuses, _, err := gh.client.Repositories.ListDeploymentStatuses(ctx, owner, repo, deployments[0].GetID(), &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", fmt.Errorf("failed to list deployment statuses: %w", err)
+	}
+	// statuses are listed from the newest as well.
+	for _, s := range statuses {
+		if s.GetState() != "inactive" {
+			return s.GetState(), nil
+		}
+	}
+	return "pending", nil
+}
+
+// deploymentState converts deployment status into check state.
+func deploymentState(status string) string {
+	switch status {
+	case "success":
+		return checkSuccess
+	case "error", "failure":
+		return checkFailure
+	default:
+		// not deployed, queued, pending and in_progress deployments may succeed later.
+		return checkPending
+	}
+}
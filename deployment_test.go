@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_ghClient_waitDeployment(t *testing.T) {
+	tests := []struct {
+		name         string
+		deployments  string
+		statuses     string
+		wantErr      string
+		wantComments []string
+	}{
+		{
+			name:        "succeeded",
+			deployments: `[{"id":5}]`,
+			statuses:    `[{"state":"success"},{"state":"in_progress"}]`,
+		},
+		{
+			name:        "superseded after success",
+			deployments: `[{"id":5}]`,
+			statuses:    `[{"state":"inactive"},{"state":"success"}]`,
+		},
+		{
+			name:        "failed",
+			deployments: `[{"id":5}]`,
+			statuses:    `[{"state":"failure"}]`,
+			wantErr:     "deployment to environment preview did not succeed: failure",
+		},
+		{
+			name:        "not deployed until the job deadline",
+			deployments: `[]`,
+			wantErr:     "deployment to environment preview is still not deployed",
+			wantComments: []string{
+				"Waiting for deployment of sha to environment preview.\n\nCurrent deployment status: not deployed.",
+				"Waiting for deployment of sha to environment preview.\n\nCurrent deployment status: not deployed.\n\nDeployment did not pass: deployment to environment preview is still not deployed",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var comments []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/deployments":
+					if got := r.URL.Query(); got.Get("sha") != "sha" || got.Get("environment") != "preview" {
+						t.Errorf("query = %v", got)
+					}
+					w.Write([]byte(tt.deployments))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/deployments/5/statuses":
+					w.Write([]byte(tt.statuses))
+				case r.Method == http.MethodPost && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments",
+					r.Method == http.MethodPatch && r.URL.Path == "/repos/abema/github-actions-merger/issues/comments/10":
+					var c github.IssueComment
+					json.NewDecoder(r.Body).Decode(&c)
+					comments = append(comments, c.GetBody())
+					w.Write([]byte(`{"id":10}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			pr := &github.PullRequest{
+				Number: github.Int(1),
+				Head:   &github.PullRequestBranch{SHA: github.String("sha")},
+			}
+			// the job deadline comes right after the margin.
+			ctx, cancel := context.WithTimeout(context.Background(), deploymentMargin+time.Millisecond)
+			defer cancel()
+			err := gh.waitDeployment(ctx, env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}, pr, "preview")
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("ghClient.waitDeployment() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(comments, tt.wantComments) {
+				t.Errorf("comments = %q, want %q", comments, tt.wantComments)
+			}
+		})
+	}
+}
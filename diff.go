@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// diffContext is the number of unchanged lines around changes in diffs.
+const diffContext = 3
+
+// commitMessageMarkerRegexp matches the hidden marker of the commit message generated by an attempt.
+var commitMessageMarkerRegexp = regexp.MustCompile(`<!-- github-actions-merger:commit-message ([A-Za-z0-9+/=]*) -->`)
+
+// commitMessageMarker returns a hidden marker embedding msg in messages of the attempt, to diff it on the next attempt.
+// msg is base64 encoded since it may contain the end of html comments.
+func commitMessageMarker(msg string) string {
+	return fmt.Sprintf("<!-- github-actions-merger:commit-message %s -->", base64.StdEncoding.EncodeToString([]byte(msg)))
+}
+
+// commitMessageError is an error of the attempt which generated the commit message.
+type commitMessageError struct {
+	commitMsg string
+	err       error
+}
+
+func (e *commitMessageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commitMessageError) Unwrap() error {
+	return e.err
+}
+
+// attemptedCommitMessage returns the commit message generated by the failed attempt if any.
+func attemptedCommitMessage(err error) (string, bool) {
+	var cerr *commitMessageError
+	if errors.As(err, &cerr) {
+		return cerr.commitMsg, true
+	}
+	return "", false
+}
+
+// lastCommitMessage returns the commit message embedded in the latest message of previous attempts.
+func (gh *ghClient) lastCommitMessage(ctx context.Context, owner, repo string, prNumber int) (string, bool, error) {
+	last, found := "", false
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := gh.client.Issues.ListComments(ctx, owner, repo, prNumber, opt)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to list comments: %w", err)
+		}
+		// comments are listed in chronological order.
+		for _, c := range comments {
+			ms := commitMessageMarkerRegexp.FindAllStringSubmatch(c.GetBody(), -1)
+			if len(ms) == 0 {
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(ms[len(ms)-1][1])
+			if err != nil {
+				logger.Warnf("ignore broken commit message marker of comment %d: %v", c.GetID(), err)
+				continue
+			}
+			last, found = string(b), true
+		}
+		if resp.NextPage == 0 {
+			return last, found, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// postCommitMessageDiff posts a diff of commitMsg against the commit message of the previous attempt if it changed.
+// nothing is posted on the first attempt.
+func (gh *ghClient) postCommitMessageDiff(ctx context.Context, owner, repo string, prNumber int, commitMsg string) error {
+	last, found, err := gh.lastCommitMessage(ctx, owner, repo, prNumber)
+	if err != nil || !found || last == commitMsg {
+		return err
+	}
+	return gh.sendMsg(ctx, owner, repo, prNumber, fmt.Sprintf("Commit message changed since the last attempt:\n\n```diff\n%s```", unifiedDiff(last, commitMsg)))
+}
+
+// diffLine is a line of diffs. op is ' ' for unchanged lines, '-' for removed lines and '+' for added lines.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the unified diff of lines from a to b.
+func unifiedDiff(a, b string) string {
+	lines := diffLines(strings.Split(a, "\n"), strings.Split(b, "\n"))
+	var out strings.Builder
+	out.WriteString("--- previous\n+++ current\n")
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		// changes separated by at most twice the context are in the same hunk.
+		end := i
+		for j := i; j < len(lines) && j-end <= 2*diffContext; j++ {
+			if lines[j].op != ' ' {
+				end = j
+			}
+		}
+		start, stop := i-diffContext, end+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		aStart, bStart := 1, 1
+		for _, l := range lines[:start] {
+			if l.op != '+' {
+				aStart++
+			}
+			if l.op != '-' {
+				bStart++
+			}
+		}
+		aLen, bLen := 0, 0
+		for _, l := range lines[start:stop] {
+			if l.op != '+' {
+				aLen++
+			}
+			if l.op != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, l := range lines[start:stop] {
+			fmt.Fprintf(&out, "%c%s\n", l.op, l.text)
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk. empty ranges start at the line before.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, n)
+	}
+}
+
+// diffLines returns lines from a to b based on their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_unifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "changed line",
+			a:    "title\n\nold description",
+			b:    "title\n\nnew description",
+			want: "--- previous\n+++ current\n@@ -1,3 +1,3 @@\n title\n \n-old description\n+new description\n",
+		},
+		{
+			name: "added lines",
+			a:    "title",
+			b:    "title\n\nLabels:\n* bug",
+			want: "--- previous\n+++ current\n@@ -1 +1,4 @@\n title\n+\n+Labels:\n+* bug\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12",
+			b:    "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve",
+			want: "--- previous\n+++ current\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "removed from empty",
+			a:    "title",
+			b:    "",
+			want: "--- previous\n+++ current\n@@ -1 +1 @@\n-title\n+\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff(tt.a, tt.b); got != tt.want {
+				t.Errorf("unifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_attemptedCommitMessage(t *testing.T) {
+	err := fmt.Errorf("failed to merge: %w", &commitMessageError{commitMsg: "body", err: errors.New("Pull Request is not mergeable")})
+	if got, ok := attemptedCommitMessage(err); !ok || got != "body" {
+		t.Errorf("attemptedCommitMessage() = %v, %v, want body, true", got, ok)
+	}
+	if _, ok := attemptedCommitMessage(errors.New("Pull Request is not mergeable")); ok {
+		t.Error("attemptedCommitMessage() should not find the commit message")
+	}
+}
+
+func Test_ghClient_postCommitMessageDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments []*github.IssueComment
+		want     string
+	}{
+		{
+			name:     "first attempt",
+			comments: []*github.IssueComment{{Body: github.String("/merge")}},
+		},
+		{
+			name: "changed since the latest attempt",
+			comments: []*github.IssueComment{
+				{Body: github.String("❌ conflict\n" + commitMessageMarker("older"))},
+				{Body: github.String("❌ conflict\n" + commitMessageMarker("old"))},
+			},
+			want: "Commit message changed since the last attempt:\n\n```diff\n--- previous\n+++ current\n@@ -1 +1 @@\n-old\n+new\n```",
+		},
+		{
+			name:     "unchanged",
+			comments: []*github.IssueComment{{Body: github.String("❌ conflict\n" + commitMessageMarker("new"))}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/abema/github-actions-merger/issues/1/comments" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				switch r.Method {
+				case http.MethodGet:
+					if err := json.NewEncoder(w).Encode(tt.comments); err != nil {
+						t.Error(err)
+					}
+				case http.MethodPost:
+					var c github.IssueComment
+					if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+						t.Error(err)
+					}
+					got = c.GetBody()
+					w.Write([]byte(`{"id":1}`))
+				}
+			}))
+			if err := gh.postCommitMessageDiff(context.Background(), "abema", "github-actions-merger", 1, "new"); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.postCommitMessageDiff() posted %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
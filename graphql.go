@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// graphqlError is an error returned in errors of github graphql api response.
+type graphqlError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// graphql posts query to github graphql api and decodes data of the response into v.
+// GitHub API docs: https://docs.github.com/en/graphql/guides/forming-calls-with-graphql
+func (gh *ghClient) graphql(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	req, err := gh.client.NewRequest(http.MethodPost, "graphql", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphqlError  `json:"errors"`
+	}
+	if _, err := gh.client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		msgs := make([]string, 0, len(resp.Errors))
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("graphql error: %s", strings.Join(msgs, ", "))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, v)
+}
+
+const mergeQueueQuery = `query($owner: String!, $repo: String!, $branch: String!) {
+  repository(owner: $owner, name: $repo) {
+    mergeQueue(branch: $branch) {
+      id
+    }
+  }
+}`
+
+const enqueuePullRequestMutation = `mutation($id: ID!, $sha: GitObjectID) {
+  enqueuePullRequest(input: {pullRequestId: $id, expectedHeadOid: $sha}) {
+    mergeQueueEntry {
+      position
+    }
+  }
+}`
+
+const autoMergeRequestQuery = `query($owner: String!, $repo: String!, $number: Int!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      id
+      autoMergeRequest {
+        enabledAt
+      }
+    }
+  }
+}`
+
+const disableAutoMergeMutation = `mutation($id: ID!) {
+  disablePullRequestAutoMerge(input: {pullRequestId: $id}) {
+    clientMutationId
+  }
+}`
+
+const reviewThreadsQuery = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        nodes {
+          isResolved
+        }
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+      }
+    }
+  }
+}`
+
+// hasMergeQueue returns whether merge queue is configured for the branch.
+func (gh *ghClient) hasMergeQueue(ctx context.Context, owner, repo, branch string) (bool, error) {
+	var data struct {
+		Repository struct {
+			MergeQueue *struct {
+				ID string `json:"id"`
+			} `json:"mergeQueue"`
+		} `json:"repository"`
+	}
+	if err := gh.graphql(ctx, mergeQueueQuery, map[string]interface{}{
+		"owner":  owner,
+		"repo":   repo,
+		"branch": branch,
+	}, &data); err != nil {
+		return false, fmt.Errorf("failed to get merge queue: %w", err)
+	}
+	return data.Repository.MergeQueue != nil, nil
+}
+
+// enqueue adds the pull request to the merge queue.
+// commit message is not passed since the merge queue generates it by its own settings.
+func (gh *ghClient) enqueue(ctx context.Context, pr *github.PullRequest) error {
+	if err := gh.graphql(ctx, enqueuePullRequestMutation, map[string]interface{}{
+		"id":  pr.GetNodeID(),
+		"sha": pr.GetHead().GetSHA(),
+	}, nil); err != nil {
+		return fmt.Errorf("failed to enqueue pull request: %w", err)
+	}
+	return nil
+}
+
+// cancelAutoMerge disables auto merge of the pull request, and returns whether it was enabled.
+func (gh *ghClient) cancelAutoMerge(ctx context.Context, owner, repo string, prNumber int) (bool, error) {
+	var data struct {
+		Repository struct {
+			PullRequest struct {
+				ID               string `json:"id"`
+				AutoMergeRequest *struct {
+					EnabledAt string `json:"enabledAt"`
+				} `json:"autoMergeRequest"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	if err := gh.graphql(ctx, autoMergeRequestQuery, map[string]interface{}{
+		"owner":  owner,
+		"repo":   repo,
+		"number": prNumber,
+	}, &data); err != nil {
+		return false, fmt.Errorf("failed to get auto merge: %w", err)
+	}
+	if data.Repository.PullRequest.AutoMergeRequest == nil {
+		return false, nil
+	}
+	if err := gh.graphql(ctx, disableAutoMergeMutation, map[string]interface{}{
+		"id": data.Repository.PullRequest.ID,
+	}, nil); err != nil {
+		return false, fmt.Errorf("failed to disable auto merge: %w", err)
+	}
+	return true, nil
+}
+
+// unresolvedConversations returns the number of unresolved review threads of the pull request.
+func (gh *ghClient) unresolvedConversations(ctx context.Context, owner, repo string, prNumber int) (int, error) {
+	n := 0
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						Nodes []struct {
+							IsResolved bool `json:"isResolved"`
+						} `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		if err := gh.graphql(ctx, reviewThreadsQuery, map[string]interface{}{
+			"owner":  owner,
+			"repo":   repo,
+			"number": prNumber,
+			"cursor": cursor,
+		}, &data); err != nil {
+			return 0, fmt.Errorf("failed to get review threads: %w", err)
+		}
+		threads := data.Repository.PullRequest.ReviewThreads
+		for _, t := range threads.Nodes {
+			if !t.IsResolved {
+				n++
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			return n, nil
+		}
+		cursor = &threads.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func Test_ghClient_hasMergeQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:     "merge queue configured",
+			response: `{"data":{"repository":{"mergeQueue":{"id":"MQ_1"}}}}`,
+			want:     true,
+		},
+		{
+			name:     "merge queue not configured",
+			response: `{"data":{"repository":{"mergeQueue":null}}}`,
+		},
+		{
+			name:     "graphql error",
+			response: `{"data":null,"errors":[{"type":"NOT_FOUND","message":"Could not resolve to a Repository"}]}`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/graphql" {
+					t.Errorf("request path = %s, want /graphql", r.URL.Path)
+				}
+				var body struct {
+					Variables map[string]string `json:"variables"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if body.Variables["branch"] != "main" {
+					t.Errorf("branch = %s, want main", body.Variables["branch"])
+				}
+				w.Write([]byte(tt.response))
+			}))
+			got, err := gh.hasMergeQueue(context.Background(), "abema", "github-actions-merger", "main")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.hasMergeQueue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.hasMergeQueue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_unresolvedConversations(t *testing.T) {
+	pages := map[string]string{
+		"":      `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[{"isResolved":true},{"isResolved":false}],"pageInfo":{"hasNextPage":true,"endCursor":"next"}}}}}}`,
+		"next":  `{"data":{"repository":{"pullRequest":{"reviewThreads":{"nodes":[{"isResolved":false},{"isResolved":false}],"pageInfo":{"hasNextPage":false,"endCursor":"last"}}}}}}`,
+		"error": `{"data":null,"errors":[{"type":"NOT_FOUND","message":"Could not resolve to a PullRequest"}]}`,
+	}
+	tests := []struct {
+		name    string
+		first   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "unresolved threads of every page",
+			want: 3,
+		},
+		{
+			name:    "graphql error",
+			first:   "error",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Variables struct {
+						Number int     `json:"number"`
+						Cursor *string `json:"cursor"`
+					} `json:"variables"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if body.Variables.Number != 1 {
+					t.Errorf("number = %d, want 1", body.Variables.Number)
+				}
+				page := tt.first
+				if body.Variables.Cursor != nil {
+					page = *body.Variables.Cursor
+				}
+				w.Write([]byte(pages[page]))
+			}))
+			got, err := gh.unresolvedConversations(context.Background(), "abema", "github-actions-merger", 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.unresolvedConversations() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.unresolvedConversations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_cancelAutoMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		mutation  string
+		want      bool
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "auto merge enabled",
+			query:     `{"data":{"repository":{"pullRequest":{"id":"PR_1","autoMergeRequest":{"enabledAt":"2024-01-01T00:00:00Z"}}}}}`,
+			mutation:  `{"data":{"disablePullRequestAutoMerge":{"clientMutationId":null}}}`,
+			want:      true,
+			wantCalls: 2,
+		},
+		{
+			name:      "auto merge not enabled",
+			query:     `{"data":{"repository":{"pullRequest":{"id":"PR_1","autoMergeRequest":null}}}}`,
+			wantCalls: 1,
+		},
+		{
+			name:      "mutation error",
+			query:     `{"data":{"repository":{"pullRequest":{"id":"PR_1","autoMergeRequest":{"enabledAt":"2024-01-01T00:00:00Z"}}}}}`,
+			mutation:  `{"data":null,"errors":[{"type":"FORBIDDEN","message":"Resource not accessible by integration"}]}`,
+			wantCalls: 2,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				var body struct {
+					Query     string                 `json:"query"`
+					Variables map[string]interface{} `json:"variables"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				if body.Query == disableAutoMergeMutation {
+					if body.Variables["id"] != "PR_1" {
+						t.Errorf("id = %v, want PR_1", body.Variables["id"])
+					}
+					w.Write([]byte(tt.mutation))
+					return
+				}
+				w.Write([]byte(tt.query))
+			}))
+			got, err := gh.cancelAutoMerge(context.Background(), "abema", "github-actions-merger", 1)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.cancelAutoMerge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.cancelAutoMerge() = %v, want %v", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("ghClient.cancelAutoMerge() made %d requests, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+)
+
+// hasLinkedIssue returns true if the pull request references an issue with closing keywords in its description,
+// or an issue is linked to it manually, which is recorded as connected events in the timeline.
+func (gh *ghClient) hasLinkedIssue(ctx context.Context, owner, repo string, pr *github.PullRequest) (bool, error) {
+	if len(closingIssues(pr.GetBody())) > 0 {
+		return true, nil
+	}
+	linked := 0
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := gh.client.Issues.ListIssueTimeline(ctx, owner, repo, pr.GetNumber(), opt)
+		if err != nil {
+			return false, fmt.Errorf("failed to list timeline: %w", err)
+		}
+		for _, ev := range events {
+			switch ev.GetEvent() {
+			case "connected":
+				linked++
+			case "disconnected":
+				linked--
+			}
+		}
+		if resp.NextPage == 0 {
+			return linked > 0, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
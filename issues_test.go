@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_ghClient_hasLinkedIssue(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		timeline string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name: "closing keyword",
+			body: "Closes #123",
+			want: true,
+		},
+		{
+			name:     "linked manually",
+			body:     "refactor",
+			timeline: `[{"event":"labeled"},{"event":"connected"}]`,
+			want:     true,
+		},
+		{
+			name:     "unlinked after linked",
+			body:     "see #123",
+			timeline: `[{"event":"connected"},{"event":"disconnected"}]`,
+		},
+		{
+			name:     "no issue",
+			timeline: `[]`,
+		},
+		{
+			name:    "timeline not found",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/repos/abema/github-actions-merger/issues/1/timeline" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				if tt.timeline == "" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message":"Not Found"}`))
+					return
+				}
+				w.Write([]byte(tt.timeline))
+			}))
+			pr := &github.PullRequest{Number: github.Int(1), Body: github.String(tt.body)}
+			got, err := gh.hasLinkedIssue(context.Background(), "abema", "github-actions-merger", pr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.hasLinkedIssue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.hasLinkedIssue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
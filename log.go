@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+// leveledLogger writes logs as human-readable text or JSON lines.
+// logs below level are suppressed.
+type leveledLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	json  bool
+	level logLevel
+	now   func() time.Time
+}
+
+// logger is the logger of merger, configured by LOG_FORMAT and LOG_LEVEL.
+var logger = &leveledLogger{out: os.Stdout, level: levelInfo, now: time.Now}
+
+// newLeveledLogger returns logger with format (text|json) and level (debug|info|warn|error).
+func newLeveledLogger(out io.Writer, format, level string) (*leveledLogger, error) {
+	l := &leveledLogger{out: out, now: time.Now}
+	switch strings.ToLower(format) {
+	case "", "text":
+	case "json":
+		l.json = true
+	default:
+		return nil, fmt.Errorf("invalid log format %s, must be text or json", format)
+	}
+	found := false
+	for lv, name := range logLevelNames {
+		if strings.EqualFold(level, name) {
+			l.level, found = lv, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("invalid log level %s, must be debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+func (l *leveledLogger) Debugf(format string, a ...interface{}) { l.logf(levelDebug, format, a...) }
+func (l *leveledLogger) Infof(format string, a ...interface{})  { l.logf(levelInfo, format, a...) }
+func (l *leveledLogger) Warnf(format string, a ...interface{})  { l.logf(levelWarn, format, a...) }
+func (l *leveledLogger) Errorf(format string, a ...interface{}) { l.logf(levelError, format, a...) }
+
+func (l *leveledLogger) logf(level logLevel, format string, a ...interface{}) {
+	if level < l.level {
+		return
+	}
+	msg := fmt.Sprintf(format, a...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.json {
+		fmt.Fprintf(l.out, "[%s] %s\n", strings.ToUpper(logLevelNames[level]), msg)
+		return
+	}
+	b, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{
+		Time:  l.now().UTC().Format(time.RFC3339),
+		Level: logLevelNames[level],
+		Msg:   msg,
+	})
+	if err != nil {
+		fmt.Fprintf(l.out, "[%s] %s\n", strings.ToUpper(logLevelNames[level]), msg)
+		return
+	}
+	fmt.Fprintf(l.out, "%s\n", b)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_leveledLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		level   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "text",
+			format: "text",
+			level:  "info",
+			want:   "[INFO] merged\n[WARN] retrying\n",
+		},
+		{
+			name:   "json",
+			format: "json",
+			level:  "warn",
+			want:   `{"time":"2023-01-02T03:04:05Z","level":"warn","msg":"retrying"}` + "\n",
+		},
+		{
+			name:   "debug",
+			format: "",
+			level:  "DEBUG",
+			want:   "[DEBUG] got pull request\n[INFO] merged\n[WARN] retrying\n",
+		},
+		{
+			name:    "invalid format",
+			format:  "yaml",
+			level:   "info",
+			wantErr: true,
+		},
+		{
+			name:    "invalid level",
+			format:  "text",
+			level:   "verbose",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			l, err := newLeveledLogger(out, tt.format, tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newLeveledLogger() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			l.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+			l.Debugf("got pull request")
+			l.Infof("merged")
+			l.Warnf("retrying")
+			if got := out.String(); got != tt.want {
+				t.Errorf("leveledLogger output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,13 +3,20 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/go-github/github"
 	"github.com/kelseyhightower/envconfig"
@@ -17,196 +24,2090 @@ import (
 )
 
 type env struct {
-	GithubToken     string   `envconfig:"GITHUB_TOKEN"`
-	Owner           string   `envconfig:"OWNER"`
-	Repo            string   `envconfig:"REPO"`
-	PRNumber        int      `envconfig:"PR_NUMBER"`
-	Comment         string   `envconfig:"COMMENT"`
-	MergeMethod     string   `envconfig:"MERGE_METHOD" default:"merge"`
-	Mergers         []string `envconfig:"MERGERS"`
-	Actor           string   `envconfig:"GITHUB_ACTOR"` // github user who initiated the workflow.
-	EnableAutoMerge bool     `envconfig:"ENABLE_AUTO_MERGE" default:"false"`
+	GithubToken      string     `envconfig:"GITHUB_TOKEN"`
+	Owner            string     `envconfig:"OWNER"`
+	Repo             string     `envconfig:"REPO"`
+	PRNumber         int        `envconfig:"PR_NUMBER"`
+	Comment          string     `envconfig:"COMMENT"`
+	MergeMethod      string     `envconfig:"MERGE_METHOD" default:"merge"`
+	Mergers          []string   `envconfig:"MERGERS"`
+	Actor            string     `envconfig:"GITHUB_ACTOR"`        // github user who initiated the workflow.
+	OutputFile       string     `envconfig:"GITHUB_OUTPUT"`       // file to set outputs of the step.
+	StepSummaryFile  string     `envconfig:"GITHUB_STEP_SUMMARY"` // file to add the job summary.
+	EnableAutoMerge  bool       `envconfig:"ENABLE_AUTO_MERGE" default:"false"`
+	TriggerComment   string     `envconfig:"TRIGGER_COMMENT" default:"/merge"`
+	Commands         commandMap `envconfig:"COMMAND_MAP" default:"/squash=squash,/rebase=rebase"`
+	RequireChecks    bool       `envconfig:"REQUIRE_CHECKS" default:"false"`
+	MinApprovals     int        `envconfig:"MIN_APPROVALS" default:"0"`
+	BlockLabels      []string   `envconfig:"BLOCK_LABELS"`
+	RequireLabels    []string   `envconfig:"REQUIRE_LABELS"`
+	BodyTemplate     string     `envconfig:"COMMIT_BODY_TEMPLATE"`
+	BodyTemplateFile string     `envconfig:"COMMIT_BODY_TEMPLATE_FILE"`
+	SubjectTemplate  string     `envconfig:"COMMIT_SUBJECT_TEMPLATE"`
+	AllowDraftMerge  bool       `envconfig:"ALLOW_DRAFT_MERGE" default:"false"`
+	UseMergeQueue    bool       `envconfig:"USE_MERGE_QUEUE" default:"false"`
+	CommitterName    string     `envconfig:"COMMITTER_NAME"`
+	CommitterEmail   string     `envconfig:"COMMITTER_EMAIL"`
+	CloseComment     string     `envconfig:"CLOSE_COMMENT" default:"/close"`
+	CancelComment    string     `envconfig:"CANCEL_COMMENT" default:"/merge cancel"`
+	AutoApprove      bool       `envconfig:"AUTO_APPROVE" default:"false"`
+	// JobTimeoutSeconds is parsed by jobTimeout to fallback to the default on invalid values.
+	JobTimeoutSeconds  string `envconfig:"JOB_TIMEOUT_SECONDS" default:"600"`
+	RequireWriteAccess bool   `envconfig:"REQUIRE_WRITE_ACCESS" default:"false"`
+	UpdateBranch       bool   `envconfig:"UPDATE_BRANCH" default:"false"`
+	IncludeCommits     bool   `envconfig:"INCLUDE_COMMITS" default:"false"`
+	MaxCommits         int    `envconfig:"MAX_COMMITS" default:"50"`
+	IncludeCoauthors   bool   `envconfig:"INCLUDE_COAUTHORS" default:"false"`
+	MaxRetries         int    `envconfig:"MAX_RETRIES" default:"3"`
+	SquashUsePRBody    bool   `envconfig:"SQUASH_USE_PR_BODY" default:"false"`
+	// MergeabilityTimeout is how long to wait for github to compute mergeability. zero disables waiting.
+	MergeabilityTimeout time.Duration `envconfig:"MERGEABILITY_TIMEOUT" default:"0s"`
+	LogFormat           string        `envconfig:"LOG_FORMAT" default:"text"`
+	LogLevel            string        `envconfig:"LOG_LEVEL" default:"info"`
+	NotifyWebhookURL    string        `envconfig:"NOTIFY_WEBHOOK_URL"`
+	NotifyWebhookSecret string        `envconfig:"NOTIFY_WEBHOOK_SECRET"`
+	ProtectedPaths      []string      `envconfig:"PROTECTED_PATHS"`
+	Emoji               bool          `envconfig:"EMOJI" default:"true"`
+	ErrorPrefix         string        `envconfig:"ERROR_PREFIX" default:"❌"`
+	SignCommits         bool          `envconfig:"SIGN_COMMITS" default:"false"`
+	SigningKey          string        `envconfig:"SIGNING_KEY"`
+	SigningFormat       string        `envconfig:"SIGNING_FORMAT"` // openpgp, x509 or ssh. git default is used if empty.
+	BoilerplatePatterns []string      `envconfig:"BOILERPLATE_PATTERNS"`
+	MinOpenMinutes      int           `envconfig:"MIN_OPEN_MINUTES" default:"0"`
+	RerunChecks         bool          `envconfig:"RERUN_CHECKS" default:"false"`
+	RerunChecksTimeout  time.Duration `envconfig:"RERUN_CHECKS_TIMEOUT" default:"10m"`
+	LabelCategories     categoryMap   `envconfig:"LABEL_CATEGORY_MAP"`
+	ReleaseNote         bool          `envconfig:"RELEASE_NOTE" default:"true"`
+	MergeWindow         mergeWindow   `envconfig:"MERGE_WINDOW"`
+	AutoMergeLabel      string        `envconfig:"AUTO_MERGE_LABEL"`
+	LabelIgnore         []string      `envconfig:"COMMIT_BODY_LABEL_IGNORE"`
+	SelfTest            bool          `envconfig:"SELF_TEST" default:"false"`
+	QuoteDescription    bool          `envconfig:"QUOTE_DESCRIPTION" default:"false"`
+	Metrics             bool          `envconfig:"METRICS" default:"false"`
+	FallbackMergeMethod string        `envconfig:"FALLBACK_MERGE_METHOD"`
+	ReleaseNoteFence    string        `envconfig:"RELEASE_NOTE_FENCE" default:"release-note"`
+	SlackWebhookURL     string        `envconfig:"SLACK_WEBHOOK_URL"`
+	CommentSource       string        `envconfig:"COMMENT_SOURCE" default:"issue"`
+	// LinearHistoryMergeMethod is used instead of merge when the base branch requires linear history. merge is refused if empty.
+	LinearHistoryMergeMethod string `envconfig:"LINEAR_HISTORY_MERGE_METHOD"`
+	// RenderTemplate is the path to a JSON file of a pull request to print the commit message rendered for, without merging.
+	RenderTemplate string `envconfig:"RENDER_TEMPLATE"`
+	// RequireCodeOwners refuses to merge while review requests of code owners of changed files are pending or code owners request changes.
+	RequireCodeOwners bool `envconfig:"REQUIRE_CODEOWNERS" default:"false"`
+	// QuietSuccess skips posting the success message, while errors are still posted.
+	QuietSuccess bool `envconfig:"QUIET_SUCCESS" default:"false"`
+	// RequireResolvedConversations refuses to merge while review threads are unresolved. it costs graphql requests.
+	RequireResolvedConversations bool `envconfig:"REQUIRE_RESOLVED_CONVERSATIONS" default:"false"`
+	// MergersFile is the path to a file of the repository listing mergers in addition to MERGERS.
+	MergersFile string `envconfig:"MERGERS_FILE"`
+	// AutoUpdateAndWait updates the branch and waits for checks of the updated head before evaluating them. requires REQUIRE_CHECKS.
+	AutoUpdateAndWait     bool          `envconfig:"AUTO_UPDATE_AND_WAIT" default:"false"`
+	AutoUpdateGracePeriod time.Duration `envconfig:"AUTO_UPDATE_GRACE_PERIOD" default:"1m"`
+	// AutoUpdateStrict refuses to merge if no check starts for the updated head within AUTO_UPDATE_GRACE_PERIOD.
+	AutoUpdateStrict bool `envconfig:"AUTO_UPDATE_STRICT" default:"false"`
+	// MaxChangedFiles and MaxChangedLines refuse to merge large pull requests. zero means no limit.
+	MaxChangedFiles int `envconfig:"MAX_CHANGED_FILES" default:"0"`
+	MaxChangedLines int `envconfig:"MAX_CHANGED_LINES" default:"0"`
+	// SizeOverrideLabel allows to merge pull requests exceeding the size limits.
+	SizeOverrideLabel string `envconfig:"SIZE_OVERRIDE_LABEL"`
+	// AppID, InstallationID and PrivateKey authenticate as the installation of a github app instead of GITHUB_TOKEN.
+	AppID          int64  `envconfig:"APP_ID"`
+	InstallationID int64  `envconfig:"INSTALLATION_ID"`
+	PrivateKey     string `envconfig:"PRIVATE_KEY"`
+	// DebugPanic panics on failures to dump goroutine stacks instead of exiting with status 1.
+	DebugPanic bool `envconfig:"DEBUG_PANIC" default:"false"`
+	// AckComment acknowledges the trigger comment before merge, by a reaction or a comment according to AckStyle.
+	AckComment bool   `envconfig:"ACK_COMMENT" default:"false"`
+	AckStyle   string `envconfig:"ACK_STYLE" default:"reaction"`
+	// CommentID is the id of the trigger comment, which reactions are added to.
+	CommentID int64 `envconfig:"COMMENT_ID"`
+	// WaitForApproval enables auto merge instead of refusing when approvals are missing, so that github merges once they land.
+	WaitForApproval bool `envconfig:"WAIT_FOR_APPROVAL" default:"false"`
+	// ReleaseNoteStrip is a regular expression of lines removed from extracted release notes, e.g. stray checklists.
+	ReleaseNoteStrip string `envconfig:"RELEASE_NOTE_STRIP"`
+	// RequireCheckName is a check which must succeed regardless of branch protection. merger waits for it within RequireCheckTimeout.
+	RequireCheckName    string        `envconfig:"REQUIRE_CHECK_NAME"`
+	RequireCheckTimeout time.Duration `envconfig:"REQUIRE_CHECK_TIMEOUT" default:"10m"`
+	// AllowAssignees authorizes assignees of the pull request in addition to mergers.
+	AllowAssignees bool `envconfig:"ALLOW_ASSIGNEES" default:"false"`
+	// LabelStyle is how the built-in template renders labels. list, inline or none.
+	LabelStyle string `envconfig:"LABEL_STYLE" default:"list"`
+	// AllowForkMerge allows to merge pull requests from forks. ForkMergeLabel is additionally required for them if set.
+	AllowForkMerge bool   `envconfig:"ALLOW_FORK_MERGE" default:"true"`
+	ForkMergeLabel string `envconfig:"FORK_MERGE_LABEL"`
+	// MessageTemplate renders messages posted to the pull request. plain messages are posted if empty.
+	MessageTemplate string `envconfig:"MESSAGE_TEMPLATE"`
+	// LabelMethods selects the merge method by labels of the pull request instead of MergeMethod. commands of COMMAND_MAP take precedence.
+	LabelMethods labelMethodMap `envconfig:"LABEL_METHOD_MAP"`
+	// CommitMessageDiff records the commit message in messages of each attempt, and posts its diff on the next attempt if it changed.
+	CommitMessageDiff bool `envconfig:"COMMIT_MESSAGE_DIFF" default:"false"`
+	// RequireUpToDate refuses to merge pull requests behind the base branch, unless UPDATE_BRANCH updates them.
+	RequireUpToDate bool `envconfig:"REQUIRE_UP_TO_DATE" default:"false"`
+	// MaxCommentBytes truncates messages posted to the pull request, since github refuses comments longer than 65536 characters.
+	MaxCommentBytes int `envconfig:"MAX_COMMENT_BYTES" default:"65000"`
+	// RequireDeploymentEnv is an environment which the pull request head must be deployed to successfully. merger waits for it until the job timeout.
+	RequireDeploymentEnv string `envconfig:"REQUIRE_DEPLOYMENT_ENV"`
+	// PostMergeLabel is added to the pull request after merge for downstream automation.
+	PostMergeLabel string `envconfig:"POST_MERGE_LABEL"`
+	// PreviewBeforeMerge posts the commit subject and body before merge, as an audit trail of what is committed.
+	PreviewBeforeMerge bool `envconfig:"PREVIEW_BEFORE_MERGE" default:"false"`
+	// RequireLinkedIssue refuses to merge pull requests which reference no issue, for traceability.
+	RequireLinkedIssue bool `envconfig:"REQUIRE_LINKED_ISSUE" default:"false"`
+	// EmptyMergersPolicy is allow or deny, which decides whether everyone or no one is allowed when mergers are not configured.
+	EmptyMergersPolicy string `envconfig:"EMPTY_MERGERS_POLICY" default:"allow"`
+	// TargetRepos are repositories listed as owner/repo whose pull requests can be targeted by comments .e.g. /merge owner/repo#123
+	TargetRepos []string `envconfig:"TARGET_REPOS"`
+	// StrictCommentMatch requires the comment to start with the trigger instead of equal to it.
+	StrictCommentMatch bool   `envconfig:"STRICT_COMMENT_MATCH" default:"false"`
+	BotMention         string `envconfig:"BOT_MENTION"`
+	// ProtectedPathsOverrideLabel allows to merge pull requests which touch protected paths.
+	ProtectedPathsOverrideLabel string `envconfig:"PROTECTED_PATHS_OVERRIDE_LABEL"`
+}
+
+// commandMap maps trigger comments to merge methods.
+// format must be comma separated pairs of comment and merge method .e.g. /squash=squash,/rebase=rebase
+type commandMap map[string]string
+
+// Decode implements envconfig.Decoder.
+func (m *commandMap) Decode(value string) error {
+	pairs, err := parsePairs(value, "command", "comment=method")
+	if err != nil {
+		return err
+	}
+	*m = pairs
+	return nil
+}
+
+// categoryMap maps labels to release note categories.
+// format must be comma separated pairs of label and category .e.g. kind/feature=feature,kind/bug=bugfix
+type categoryMap map[string]string
+
+// Decode implements envconfig.Decoder.
+func (m *categoryMap) Decode(value string) error {
+	pairs, err := parsePairs(value, "label category", "label=category")
+	if err != nil {
+		return err
+	}
+	*m = pairs
+	return nil
+}
+
+// labelMethodMap maps labels to merge methods.
+// format must be comma separated pairs of label and merge method .e.g. squash-me=squash,rebase-me=rebase
+type labelMethodMap map[string]string
+
+// Decode implements envconfig.Decoder.
+func (m *labelMethodMap) Decode(value string) error {
+	pairs, err := parsePairs(value, "label method", "label=method")
+	if err != nil {
+		return err
+	}
+	*m = pairs
+	return nil
+}
+
+// parsePairs parses comma separated key=value pairs. name and format are used in the error message.
+func parsePairs(value, name, format string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid %s %q, format must be %s", name, pair, format)
+		}
+		pairs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return pairs, nil
 }
 
 const (
-	mergeComment = "/merge"
-	jobTimeout   = 10 * 60 * time.Second
+	defaultJobTimeout = 10 * 60 * time.Second
+	// mergeabilityInterval is the first interval of polling mergeability, which doubles up to mergeabilityMaxInterval.
+	mergeabilityInterval    = time.Second
+	mergeabilityMaxInterval = 8 * time.Second
 )
 
 func main() {
 	var e env
 	err := envconfig.Process("INPUT", &e)
 	if err != nil {
-		fmt.Printf("failed to load inputs: %s\n", err.Error())
-		panic(err.Error())
+		logger.Errorf("failed to load inputs: %s", err.Error())
+		abort(e, err.Error())
+	}
+	if l, err := newLeveledLogger(os.Stdout, e.LogFormat, e.LogLevel); err != nil {
+		logger.Warnf("failed to configure logger, fallback to default: %v", err)
+	} else {
+		logger = l
+	}
+	if e.RenderTemplate != "" {
+		// templates are rendered locally without the token, so the config file of the workspace is used.
+		if err := loadWorkspaceConfigFile(); err != nil {
+			logger.Errorf("failed to load config file: %s", err.Error())
+			abort(e, err.Error())
+		}
+		if err := envconfig.Process("INPUT", &e); err != nil {
+			logger.Errorf("failed to load inputs: %s", err.Error())
+			abort(e, err.Error())
+		}
+		if err := renderTemplates(os.Stdout, e.RenderTemplate, e); err != nil {
+			logger.Errorf("failed to render templates: %v", err)
+			abort(e, err.Error())
+		}
+		return
+	}
+	if err := validateRequired(e); err != nil {
+		// the pull request is unknown or inaccessible without the inputs, so the error is not commented.
+		logger.Errorf("invalid inputs: %v", err)
+		abort(e, err.Error())
+	}
+	var m *metrics
+	if e.Metrics {
+		m = newMetrics(time.Now())
+		report := func() {
+			if err := m.report(os.Stdout, e.StepSummaryFile, time.Now()); err != nil {
+				logger.Warnf("failed to report metrics: %v", err)
+			}
+		}
+		// failed runs are reported as well, since abort skips deferred functions unless it panics.
+		defer report()
+		exitHooks = append(exitHooks, report)
 	}
-	ctx, f := context.WithTimeout(context.Background(), jobTimeout)
+	ctx, f := context.WithTimeout(context.Background(), jobTimeout(e.JobTimeoutSeconds))
 	defer f()
-	client := newGHClient(e.GithubToken)
-	if err := validateEnv(e); err != nil {
-		if serr := client.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, errMsg(err)); serr != nil {
-			fmt.Printf("failed to send message: %v original: %v", serr, err)
-			panic(serr.Error())
+	ts, err := tokenSource(e)
+	if err == nil && e.AppID != 0 {
+		// gh command of auto merge reads the token from the environment.
+		var tok *oauth2.Token
+		if tok, err = ts.Token(); err == nil {
+			err = os.Setenv("GH_TOKEN", tok.AccessToken)
+		}
+	}
+	if err != nil {
+		logger.Errorf("failed to authenticate: %v", err)
+		abort(e, err.Error())
+	}
+	client := newGHClient(ts, e.MaxRetries, m)
+	if err := client.loadConfigFile(ctx, e.Owner, e.Repo); err != nil {
+		logger.Errorf("failed to load config file: %s", err.Error())
+		abort(e, err.Error())
+	}
+	if err := envconfig.Process("INPUT", &e); err != nil {
+		logger.Errorf("failed to load inputs: %s", err.Error())
+		abort(e, err.Error())
+	}
+	client.maxCommentBytes = e.MaxCommentBytes
+	if e.SelfTest {
+		if err := client.selfTest(ctx, e, os.Stdout); err != nil {
+			logger.Errorf("self test failed: %v", err)
+			abort(e, err.Error())
+		}
+		return
+	}
+	cmd, err := validateEnv(e)
+	if errors.Is(err, errNotCommand) {
+		// the comment was not a merge request.
+		logger.Infof("skip merge: %v", err)
+		return
+	}
+	if err != nil {
+		err = withReason(reasonInvalidConfig, err)
+	}
+	if err == nil && e.MergersFile != "" {
+		var listed []string
+		if listed, err = client.loadMergersFile(ctx, e.Owner, e.Repo, e.MergersFile); err == nil {
+			e.Mergers = append(e.Mergers, listed...)
+		}
+		// empty mergers allow everyone, which is unlikely intended by the file.
+		if err == nil && len(e.Mergers) == 0 {
+			err = withReason(reasonInvalidConfig, fmt.Errorf("mergers file %s lists no mergers", e.MergersFile))
+		}
+	}
+	if err == nil {
+		err = client.authorize(ctx, e)
+		var uerr *unauthorizedError
+		if e.AllowAssignees && errors.As(err, &uerr) {
+			// assignees are authorized for each pull request once it is fetched.
+			uerr.assignees = true
+			cmd.unauthorized, err = uerr, nil
+		}
+	}
+	if err == nil && cmd.target != nil {
+		err = client.authorizeTarget(ctx, e, cmd)
+	}
+	var tpls *templates
+	if err == nil {
+		if tpls, err = loadTemplates(e); err != nil {
+			err = withReason(reasonInvalidConfig, err)
+		}
+	}
+	if err != nil {
+		fail(ctx, client, e, "failed to validate env", err)
+	}
+	// the ack is added to the comment, while results are reported on the target.
+	source := e
+	if cmd.target != nil {
+		e.Owner, e.Repo, e.PRNumber = cmd.target.owner, cmd.target.repo, cmd.target.number
+	}
+	if cmd.close {
+		if cmd.unauthorized != nil {
+			if err := client.authorizeAssignee(ctx, e, cmd.unauthorized); err != nil {
+				fail(ctx, client, e, "failed to validate env", err)
+			}
+		}
+		if err := client.close(ctx, e.Owner, e.Repo, e.PRNumber); err != nil {
+			fail(ctx, client, e, "failed to close", err)
+		}
+		closedMsg := fmt.Sprintf("Closed PR #%d without merging.", e.PRNumber)
+		if err := client.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, renderMessage(e, closedMsg, true, "")); err != nil {
+			logger.Errorf("failed to send message: %v", err)
+			abort(e, err.Error())
+		}
+		fmt.Print(closedMsg)
+		return
+	}
+	if cmd.cancel {
+		if cmd.unauthorized != nil {
+			if err := client.authorizeAssignee(ctx, e, cmd.unauthorized); err != nil {
+				fail(ctx, client, e, "failed to validate env", err)
+			}
+		}
+		canceled, err := client.cancelAutoMerge(ctx, e.Owner, e.Repo, e.PRNumber)
+		if err != nil {
+			fail(ctx, client, e, "failed to cancel auto merge", err)
+		}
+		canceledMsg := fmt.Sprintf("Canceled auto merge of PR #%d.", e.PRNumber)
+		if !canceled {
+			canceledMsg = fmt.Sprintf("Auto merge of PR #%d is not enabled.", e.PRNumber)
+		}
+		if err := client.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, renderMessage(e, canceledMsg, true, "")); err != nil {
+			logger.Errorf("failed to send message: %v", err)
+			abort(e, err.Error())
+		}
+		fmt.Print(canceledMsg)
+		return
+	}
+	if e.AckComment {
+		// the ack only tells that merger started, so its failure does not abort the merge.
+		if err := client.acknowledge(ctx, source); err != nil {
+			logger.Warnf("failed to acknowledge: %v", err)
 		}
-		fmt.Printf("failed to validate env: %v", err)
-		panic(err.Error())
 	}
-	if err := client.merge(ctx, e.Owner, e.Repo, e.PRNumber, e.MergeMethod, e.EnableAutoMerge); err != nil {
-		if serr := client.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, errMsg(err)); serr != nil {
-			fmt.Printf("failed to send message: %v original: %v", serr, err)
-			panic(serr.Error())
+	if len(cmd.prNumbers) > 0 {
+		results := client.mergeBatch(ctx, e, cmd, tpls)
+		summary, ok := batchSummary(results, e.TriggerComment)
+		if err := client.sendResult(ctx, e, summary, ok); err != nil {
+			logger.Errorf("failed to send message: %v", err)
+			abort(e, err.Error())
+		}
+		fmt.Print(summary)
+		for _, r := range results {
+			if r.err == nil && !r.result.duplicate {
+				pe := e
+				pe.PRNumber = r.prNumber
+				afterMerge(ctx, client, pe, r.result)
+			}
 		}
-		fmt.Printf("failed to merge: %v", err)
-		panic(err.Error())
+		if !ok {
+			logger.Errorf("failed to merge some of PRs")
+			abort(e, "failed to merge some of PRs")
+		}
+		return
+	}
+	result, err := client.merge(ctx, e, cmd, tpls)
+	if err != nil {
+		fail(ctx, client, e, "failed to merge", err)
+	}
+	// nothing is posted not to repeat the result of the comment.
+	if result.duplicate {
+		logger.Infof("skip merge: comment %d on PR #%d was already handled", result.commentID, e.PRNumber)
+		return
 	}
-	successMsg := "Merged PR #" + fmt.Sprintf("%d", e.PRNumber) + " successfully!"
-	if err := client.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, successMsg); err != nil {
-		fmt.Printf("failed to send message: %v", err)
-		panic(err.Error())
+	successMsg := mergeSummary(e.PRNumber, result)
+	if err := client.sendResult(ctx, e, successMsg, true); err != nil {
+		logger.Errorf("failed to send message: %v", err)
+		abort(e, err.Error())
 	}
-	fmt.Printf(successMsg)
+	// success message is printed as is for log scraping regardless of log format.
+	fmt.Print(successMsg)
+	afterMerge(ctx, client, e, result)
 }
 
-func validateEnv(e env) error {
-	if e.Comment != mergeComment {
-		return fmt.Errorf("comment must be %s, got %s", mergeComment, e.Comment)
+// afterMerge writes outputs, adds POST_MERGE_LABEL and notifies NOTIFY_WEBHOOK_URL of the merged pull request e.PRNumber.
+// it runs for each pull request of batch merges as well, then outputs are of the last one.
+func afterMerge(ctx context.Context, client *ghClient, e env, result *mergeResult) {
+	if e.OutputFile != "" {
+		if err := writeOutputs(e.OutputFile, result); err != nil {
+			logger.Warnf("failed to write outputs: %v", err)
+		}
 	}
-	if len(e.Mergers) == 0 {
-		return nil
+	// queued pull requests are not merged yet.
+	if e.PostMergeLabel != "" && !result.queued {
+		// the merge already completed, so failure of labeling does not fail the job.
+		if err := client.addLabel(ctx, e.Owner, e.Repo, e.PRNumber, e.PostMergeLabel); err != nil {
+			logger.Warnf("failed to add label: %v", err)
+		}
+	}
+	// the run which merged the pull request already notified.
+	if e.NotifyWebhookURL != "" && !result.alreadyMerged {
+		// the merge already completed, so failure of notification does not fail the job.
+		if err := notifyWebhook(e.NotifyWebhookURL, e.NotifyWebhookSecret, webhookPayload{
+			Repository:  fmt.Sprintf("%s/%s", e.Owner, e.Repo),
+			PRNumber:    e.PRNumber,
+			Title:       result.title,
+			MergeSHA:    result.sha,
+			Queued:      result.queued,
+			Actor:       e.Actor,
+			MergeMethod: result.mergeMethod,
+		}); err != nil {
+			logger.Warnf("failed to notify webhook: %v", err)
+		}
+	}
+}
+
+// successPrefix is the marker of succeeded messages.
+const successPrefix = "✅"
+
+// pendingPrefix marks progress of steps which are still waiting.
+const pendingPrefix = "⏳"
+
+// decorate prefixes msg posted to the pull request with a marker of the outcome,
+// so that users can tell the outcome at a glance in the timeline. markers are omitted when EMOJI is false.
+func decorate(e env, msg string, succeeded bool) string {
+	outcome := outcomeFailure
+	if succeeded {
+		outcome = outcomeSuccess
+	}
+	return decorateOutcome(e, msg, outcome)
+}
+
+// decorateOutcome prefixes msg with the marker of outcome like decorate, including pending outcomes.
+func decorateOutcome(e env, msg, outcome string) string {
+	prefix := e.ErrorPrefix
+	switch outcome {
+	case outcomeSuccess:
+		prefix = successPrefix
+	case outcomePending:
+		prefix = pendingPrefix
+	}
+	if !e.Emoji || prefix == "" {
+		return msg
+	}
+	return prefix + " " + msg
+}
+
+// exitHooks run before abort exits the process, since os.Exit skips deferred functions.
+var exitHooks []func()
+
+// osExit is replaced in tests.
+var osExit = os.Exit
+
+// abort terminates the run as failed. the message should be logged before.
+// panic dumps goroutine stacks which obscure the message in action logs, so it panics only with DEBUG_PANIC.
+func abort(e env, msg string) {
+	if e.DebugPanic {
+		panic(msg)
+	}
+	for _, f := range exitHooks {
+		f()
+	}
+	osExit(1)
+}
+
+// jobTimeout returns timeout of the job from seconds.
+// default timeout is returned with a warning if seconds is not a positive integer.
+func jobTimeout(seconds string) time.Duration {
+	s, err := strconv.Atoi(strings.TrimSpace(seconds))
+	if err != nil || s <= 0 {
+		logger.Warnf("invalid job timeout seconds %q, fallback to %s", seconds, defaultJobTimeout)
+		return defaultJobTimeout
+	}
+	return time.Duration(s) * time.Second
+}
+
+// fail posts the error to the pull request, and to slack if SLACK_WEBHOOK_URL is set, then aborts.
+func fail(ctx context.Context, client *ghClient, e env, msg string, err error) {
+	if e.OutputFile != "" {
+		if werr := writeFailureReason(e.OutputFile, failureReason(err)); werr != nil {
+			logger.Warnf("failed to write outputs: %v", werr)
+		}
+	}
+	if e.SlackWebhookURL != "" {
+		// slack supplements the comment, so failure of slack is only logged not to hide the original error.
+		if serr := notifySlack(e.SlackWebhookURL, slackFailurePayload(e, msg, err)); serr != nil {
+			logger.Warnf("failed to notify slack: %v", serr)
+		}
+	}
+	text := errMsg(err, e.TriggerComment)
+	if commitMsg, ok := attemptedCommitMessage(err); ok {
+		text += "\n" + commitMessageMarker(commitMsg) + "\n"
+	}
+	if serr := client.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, renderMessage(e, text, false, failureReason(err))); serr != nil {
+		logger.Errorf("failed to send message: %v original: %v", serr, err)
+		abort(e, serr.Error())
+	}
+	logger.Errorf("%s: %v", msg, err)
+	abort(e, err.Error())
+}
+
+var errNotCommand = errors.New("comment is not a merge command")
+
+// errCloseListed is returned when pull request numbers are listed with the close comment, which closes only the commented pull request.
+var errCloseListed = errors.New("close comment cannot list pull requests")
+
+// errInvalidTarget is returned when the pull request of another repository cannot be targeted by the comment.
+var errInvalidTarget = errors.New("invalid target")
+
+// prTarget is a pull request of another repository targeted by the comment .e.g. /merge owner/repo#123
+type prTarget struct {
+	owner  string
+	repo   string
+	number int
+}
+
+// command is a merge request parsed from the comment.
+type command struct {
+	mergeMethod string
+	// close is true when the pull request should be closed without merging.
+	close bool
+	// cancel is true when auto merge of the pull request should be disabled.
+	cancel bool
+	// message overrides the commit body generated from templates if not empty.
+	message string
+	// prNumbers are pull requests listed in the comment to merge instead of PR_NUMBER .e.g. /merge #12 #15
+	prNumbers []int
+	// commanded is true when the merge method is chosen by a command of COMMAND_MAP, which takes precedence over LABEL_METHOD_MAP.
+	commanded bool
+	// target overrides OWNER, REPO and PR_NUMBER if not nil. it must be listed in TARGET_REPOS.
+	target *prTarget
+	// unauthorized is set when the actor is not a merger but ALLOW_ASSIGNEES is true, then the actor must be an assignee of the pull request.
+	unauthorized *unauthorizedError
+}
+
+// parseCommand returns command matched with the comment.
+// TriggerComment uses MergeMethod, and Commands override it with their merge method.
+// the comment must be prefixed with BotMention if specified.
+func parseCommand(e env) (*command, error) {
+	// github often adds trailing newlines to the comment body.
+	comment := strings.TrimSpace(e.Comment)
+	if e.BotMention != "" {
+		if len(comment) < len(e.BotMention) || !strings.EqualFold(comment[:len(e.BotMention)], e.BotMention) {
+			return nil, fmt.Errorf("%w: comment must start with %s", errNotCommand, e.BotMention)
+		}
+		comment = strings.TrimSpace(comment[len(e.BotMention):])
+	}
+	// matched before the trigger, since the cancel comment may start with it .e.g. /merge cancel
+	if e.CancelComment != "" && matchComment(comment, e.CancelComment, e.StrictCommentMatch) {
+		return &command{mergeMethod: e.MergeMethod, cancel: true}, nil
+	}
+	comment, message := splitMessage(comment)
+	comment, prNumbers := splitPRNumbers(comment)
+	comment, target := splitTarget(comment)
+	if target != nil && len(prNumbers) > 0 {
+		return nil, fmt.Errorf("%w: pull request numbers cannot be listed with %s/%s#%d", errInvalidTarget, target.owner, target.repo, target.number)
+	}
+	if matchComment(comment, e.TriggerComment, e.StrictCommentMatch) {
+		return &command{mergeMethod: e.MergeMethod, message: message, prNumbers: prNumbers, target: target}, nil
+	}
+	for trigger, method := range e.Commands {
+		if matchComment(comment, trigger, e.StrictCommentMatch) {
+			return &command{mergeMethod: method, commanded: true, message: message, prNumbers: prNumbers, target: target}, nil
+		}
+	}
+	if e.CloseComment != "" && matchComment(comment, e.CloseComment, e.StrictCommentMatch) {
+		// refused rather than ignored, not to close the pull request of the comment by mistake.
+		if target != nil {
+			return nil, fmt.Errorf("%w: only merge commands can target pull requests of other repositories", errInvalidTarget)
+		}
+		if len(prNumbers) > 0 {
+			listed := make([]string, len(prNumbers))
+			for i, n := range prNumbers {
+				listed[i] = fmt.Sprintf("#%d", n)
+			}
+			return nil, fmt.Errorf("%w: %s cannot be closed by %s; comment it on each pull request", errCloseListed, strings.Join(listed, ", "), e.CloseComment)
+		}
+		return &command{mergeMethod: e.MergeMethod, close: true}, nil
+	}
+	return nil, fmt.Errorf("%w: comment must be %s, got %s", errNotCommand, e.TriggerComment, comment)
+}
+
+// splitMessage splits the commit message following "message:" from the comment .e.g. /merge message: Fix the parser bug
+func splitMessage(comment string) (string, string) {
+	loc := messageOverrideRegexp.FindStringSubmatchIndex(comment)
+	if loc == nil {
+		return comment, ""
+	}
+	return comment[:loc[0]], strings.TrimSpace(comment[loc[2]:loc[3]])
+}
+
+// splitPRNumbers splits pull request numbers listed at the end of the comment .e.g. /merge #12 #15
+// numbers are returned in order without duplicates.
+func splitPRNumbers(comment string) (string, []int) {
+	loc := prNumbersRegexp.FindStringIndex(comment)
+	if loc == nil {
+		return comment, nil
+	}
+	var numbers []int
+	seen := map[int]bool{}
+	for _, s := range strings.Fields(comment[loc[0]:]) {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "#"))
+		if err != nil || seen[n] {
+			continue
+		}
+		seen[n] = true
+		numbers = append(numbers, n)
+	}
+	return comment[:loc[0]], numbers
+}
+
+// splitTarget splits the pull request of another repository at the end of the comment .e.g. /merge owner/repo#123
+func splitTarget(comment string) (string, *prTarget) {
+	m := targetRegexp.FindStringSubmatchIndex(comment)
+	if m == nil {
+		return comment, nil
+	}
+	n, err := strconv.Atoi(comment[m[6]:m[7]])
+	if err != nil {
+		return comment, nil
+	}
+	return comment[:m[0]], &prTarget{owner: comment[m[2]:m[3]], repo: comment[m[4]:m[5]], number: n}
+}
+
+// matchComment returns whether comment equals trigger, or starts with trigger followed by spaces if prefix is true.
+func matchComment(comment, trigger string, prefix bool) bool {
+	if comment == trigger {
+		return true
+	}
+	if !prefix || trigger == "" || !strings.HasPrefix(comment, trigger) {
+		return false
+	}
+	// trigger must be a whole word, e.g. /merge does not match /mergeable.
+	rest := comment[len(trigger):]
+	return strings.TrimLeft(rest, " \t\r\n") != rest
+}
+
+var mergeMethods = []string{"merge", "squash", "rebase"}
+
+// comment sources are events which COMMENT is read from.
+const (
+	// commentSourceIssue is issue_comment events, whose comments are on the conversation of the pull request.
+	commentSourceIssue = "issue"
+	// commentSourceReview is pull_request_review_comment events, whose comments are on the diff of the pull request.
+	commentSourceReview = "review"
+)
+
+// validateRequired returns error naming the missing input, since api calls fail with opaque errors without them.
+// the pull request number is not required by the self test.
+func validateRequired(e env) error {
+	switch {
+	case e.Owner == "":
+		return errors.New("owner is required")
+	case e.Repo == "":
+		return errors.New("repo is required")
+	case e.GithubToken == "" && e.AppID == 0:
+		return errors.New("github_token is required unless app_id is specified")
+	case e.PRNumber <= 0 && !e.SelfTest:
+		return fmt.Errorf("pr_number must be a positive number, got %d", e.PRNumber)
+	}
+	return nil
+}
+
+func validateEnv(e env) (*command, error) {
+	// validated before parsing the comment, otherwise invalid sources silently skip every comment.
+	switch e.CommentSource {
+	case commentSourceIssue, commentSourceReview, "":
+	default:
+		return nil, fmt.Errorf("comment source must be %s or %s, got %s", commentSourceIssue, commentSourceReview, e.CommentSource)
+	}
+	cmd, err := parseCommand(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMergeMethod(e.MergeMethod); err != nil {
+		return nil, err
+	}
+	// merge method of commands may differ from MergeMethod.
+	if err := validateMergeMethod(cmd.mergeMethod); err != nil {
+		return nil, err
+	}
+	for label, method := range e.LabelMethods {
+		if err := validateMergeMethod(method); err != nil {
+			return nil, fmt.Errorf("label %s %w", label, err)
+		}
+	}
+	if e.FallbackMergeMethod != "" {
+		if err := validateMergeMethod(e.FallbackMergeMethod); err != nil {
+			return nil, fmt.Errorf("fallback %w", err)
+		}
+	}
+	switch e.LabelStyle {
+	case labelStyleList, labelStyleInline, labelStyleNone, "":
+	default:
+		return nil, fmt.Errorf("label style must be %s, %s or %s, got %s", labelStyleList, labelStyleInline, labelStyleNone, e.LabelStyle)
+	}
+	for _, r := range e.TargetRepos {
+		if owner, repo, ok := strings.Cut(strings.TrimSpace(r), "/"); !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("target repo must be owner/repo, got %s", r)
+		}
+	}
+	switch e.EmptyMergersPolicy {
+	case emptyMergersAllow, emptyMergersDeny, "":
+	default:
+		return nil, fmt.Errorf("empty mergers policy must be %s or %s, got %s", emptyMergersAllow, emptyMergersDeny, e.EmptyMergersPolicy)
+	}
+	switch e.AckStyle {
+	case ackReaction, ackComment, "":
+	default:
+		return nil, fmt.Errorf("ack style must be %s or %s, got %s", ackReaction, ackComment, e.AckStyle)
+	}
+	switch e.LinearHistoryMergeMethod {
+	case "", "squash", "rebase":
+	default:
+		return nil, fmt.Errorf("linear history merge method must be squash or rebase, got %s", e.LinearHistoryMergeMethod)
+	}
+	if e.AutoUpdateAndWait && !e.RequireChecks {
+		return nil, errors.New("auto update and wait requires require_checks")
 	}
-	for _, m := range e.Mergers {
-		if e.Actor == m {
-			// if actor matches specified mergers, then valid workflow run.
+	if e.SignCommits && !e.EnableAutoMerge && e.AutoMergeLabel == "" {
+		return nil, errors.New("signing commits is supported only with auto merge; set enable_auto_merge to true to sign commits")
+	}
+	return cmd, nil
+}
+
+// validateMergeMethod returns error if method is not supported by github.
+func validateMergeMethod(method string) error {
+	for _, m := range mergeMethods {
+		if method == m {
 			return nil
 		}
 	}
-	return fmt.Errorf("actor %s is not in mergers list", e.Actor)
+	return fmt.Errorf("merge method must be one of %s, got %s", strings.Join(mergeMethods, ", "), method)
 }
 
 type ghClient struct {
 	client *github.Client
+	// teamMembers caches team membership lookups within a run, keyed by team and user.
+	teamMembers map[string]bool
+	// teamRepos caches whether teams have access to repositories within a run, keyed by team and repository.
+	teamRepos map[string]bool
+	// protections caches branch protections within a run, keyed by branch.
+	protections map[string]protection
+	// maxCommentBytes is the max length of messages posted by sendMsg. zero disables truncation.
+	maxCommentBytes int
 }
 
-func newGHClient(token string) *ghClient {
+// newGHClient returns a client of github api. requests are counted in m if it is not nil.
+func newGHClient(ts oauth2.TokenSource, maxRetries int, m *metrics) *ghClient {
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
 	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	if m != nil {
+		// counted under the retries to count every attempt.
+		tc.Transport = m.transport(tc.Transport)
+	}
+	tc.Transport = newRetryTransport(tc.Transport, maxRetries)
+	return newGHClientWithHTTP(tc)
+}
+
+// newGHClientWithHTTP returns a client of github api sending requests with hc.
+// tests inject a mock transport by it to run without github.
+func newGHClientWithHTTP(hc *http.Client) *ghClient {
 	return &ghClient{
-		client: client,
+		client:      github.NewClient(hc),
+		teamMembers: map[string]bool{},
+		teamRepos:   map[string]bool{},
+		protections: map[string]protection{},
 	}
 }
 
-func (gh *ghClient) merge(ctx context.Context, owner, repo string, prNumber int, mergeMethod string, enableAutoMerge bool) error {
-	pr, _, err := gh.client.PullRequests.Get(ctx, owner, repo, prNumber)
+// close closes the pull request without merging.
+func (gh *ghClient) close(ctx context.Context, owner, repo string, prNumber int) error {
+	_, _, err := gh.client.PullRequests.Edit(ctx, owner, repo, prNumber, &github.PullRequest{
+		State: github.String("closed"),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get pull request: %w", err)
+		return fmt.Errorf("failed to close pull request: %w", err)
+	}
+	return nil
+}
+
+// addLabel adds label to the pull request. labels can be added to closed pull requests as well.
+func (gh *ghClient) addLabel(ctx context.Context, owner, repo string, prNumber int, label string) error {
+	if _, _, err := gh.client.Issues.AddLabelsToIssue(ctx, owner, repo, prNumber, []string{label}); err != nil {
+		return fmt.Errorf("failed to add label %s: %w", label, err)
+	}
+	return nil
+}
+
+// mergeResult is a result of merging a pull request.
+type mergeResult struct {
+	title       string
+	mergeMethod string
+	// sha is the merge commit sha, which is empty when the merge is queued.
+	sha string
+	// queued is true when auto merge is enabled or the pull request is added to merge queue instead of merging immediately.
+	queued bool
+	// mergeQueue is true when the pull request is added to merge queue.
+	mergeQueue    bool
+	branchDeleted bool
+	// approvedBy is the actor whose approval was added on behalf of them.
+	approvedBy string
+	// headSHA is the head of the pull request when it was handled.
+	headSHA string
+	// commentID is the trigger comment, whose success marker is embedded in the success message.
+	commentID int64
+	// duplicate is true when the trigger comment was already handled by another run, then nothing is posted.
+	duplicate bool
+	// alreadyMerged is true when the pull request was already merged, e.g. by a concurrent run.
+	alreadyMerged bool
+	mergedBy      string
+	// fallbackFrom is the merge method requested when another method was used instead since it is not allowed.
+	fallbackFrom string
+	// closedIssues are issues linked with closing keywords in the pull request description, which github closes on merge.
+	closedIssues []int
+	// releaseNotes are release notes extracted into the commit message. NONE is the only note if the pull request has none.
+	releaseNotes []string
+	// pendingApprovals are missing approvals which auto merge waits for.
+	pendingApprovals []string
+	// commitMessage is the commit message recorded in the success message to diff on the next attempt. empty unless COMMIT_MESSAGE_DIFF.
+	commitMessage string
+}
+
+func (gh *ghClient) merge(ctx context.Context, e env, cmd *command, tpls *templates) (*mergeResult, error) {
+	owner, repo, prNumber, mergeMethod := e.Owner, e.Repo, e.PRNumber, cmd.mergeMethod
+	pr, draft, err := gh.getPullRequest(ctx, owner, repo, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("got pull request %s/%s#%d head %s", owner, repo, prNumber, pr.GetHead().GetSHA())
+	if cmd.unauthorized != nil && !isAssignee(pr, e.Actor) {
+		return nil, cmd.unauthorized
+	}
+	// refused before anything is updated, e.g. the branch.
+	if draft && !e.AllowDraftMerge {
+		return nil, withReason(reasonDraft, errors.New("cannot merge a draft PR; mark it ready for review first"))
+	}
+	if pr.GetMerged() {
+		return &mergeResult{
+			title:         pr.GetTitle(),
+			mergeMethod:   mergeMethod,
+			sha:           pr.GetMergeCommitSHA(),
+			alreadyMerged: true,
+			mergedBy:      pr.GetMergedBy().GetLogin(),
+		}, nil
+	}
+	// the event may be re-delivered for the same comment.
+	if done, err := gh.hasSucceeded(ctx, owner, repo, prNumber, e.CommentID); err != nil {
+		return nil, err
+	} else if done {
+		return &mergeResult{title: pr.GetTitle(), mergeMethod: mergeMethod, headSHA: pr.GetHead().GetSHA(), commentID: e.CommentID, duplicate: true}, nil
+	}
+	if l, ok := blockingLabel(pr, e.BlockLabels); ok {
+		return nil, withReason(reasonBlockedLabel, fmt.Errorf("merge is blocked by label %s", l))
 	}
-	commitMsg, err := generateCommitBody(pr)
+	if missing := missingLabels(pr, e.RequireLabels); len(missing) > 0 {
+		return nil, withReason(reasonMissingLabels, fmt.Errorf("missing required labels: %s", strings.Join(missing, ", ")))
+	}
+	if now := time.Now(); !e.MergeWindow.contains(now) {
+		next := e.MergeWindow.next(now)
+		return nil, withReason(reasonOutsideWindow, fmt.Errorf("merge is allowed only during merge window %s; comment again after %s", e.MergeWindow, next.Format("Mon 2006-01-02 15:04 MST")))
+	}
+	if open, ok := openLongEnough(pr, e.MinOpenMinutes, time.Now()); !ok {
+		return nil, withReason(reasonTooNew, fmt.Errorf("PR must be open at least %d minutes (open for %d)", e.MinOpenMinutes, int(open.Minutes())))
+	}
+	if len(e.ProtectedPaths) > 0 && !hasLabel(pr, e.ProtectedPathsOverrideLabel) {
+		path, ok, err := gh.protectedPath(ctx, owner, repo, prNumber, e.ProtectedPaths)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if e.ProtectedPathsOverrideLabel == "" {
+				return nil, withReason(reasonProtectedPath, fmt.Errorf("merge is blocked since %s is protected", path))
+			}
+			return nil, withReason(reasonProtectedPath, fmt.Errorf("merge is blocked since %s is protected; add label %s to merge", path, e.ProtectedPathsOverrideLabel))
+		}
+	}
+	if exceeded := sizeExceeded(pr, e.MaxChangedFiles, e.MaxChangedLines); len(exceeded) > 0 && !hasLabel(pr, e.SizeOverrideLabel) {
+		msg := fmt.Sprintf("PR is too large: %s", strings.Join(exceeded, ", "))
+		if e.SizeOverrideLabel != "" {
+			msg += fmt.Sprintf("; add label %s to merge", e.SizeOverrideLabel)
+		}
+		return nil, withReason(reasonTooLarge, errors.New(msg))
+	}
+	if isFork(pr) {
+		if !e.AllowForkMerge {
+			return nil, withReason(reasonFork, errors.New("fork merges are disabled"))
+		}
+		if e.ForkMergeLabel != "" && !hasLabel(pr, e.ForkMergeLabel) {
+			return nil, withReason(reasonFork, fmt.Errorf("PR is from a fork; add label %s to merge", e.ForkMergeLabel))
+		}
+	}
+	if e.RequireLinkedIssue {
+		linked, err := gh.hasLinkedIssue(ctx, owner, repo, pr)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, withReason(reasonLinkedIssueRequired, errors.New("PR must reference an issue (Closes #...)"))
+		}
+	}
+	if !cmd.commanded {
+		method, err := labelMergeMethod(pr, e.LabelMethods)
+		if err != nil {
+			return nil, err
+		}
+		if method != "" {
+			mergeMethod = method
+		}
+	}
+	// merge commits always fail on branches requiring linear history, so they are refused before any update.
+	fallbackFrom := ""
+	if mergeMethod == "merge" {
+		base := pr.GetBase().GetRef()
+		linear, err := gh.requiresLinearHistory(ctx, owner, repo, base)
+		if err != nil {
+			return nil, err
+		}
+		if linear {
+			if e.LinearHistoryMergeMethod == "" {
+				return nil, withReason(reasonLinearHistory, fmt.Errorf("cannot create a merge commit since %s requires linear history; use squash or rebase instead", base))
+			}
+			logger.Infof("%s requires linear history, merging with %s", base, e.LinearHistoryMergeMethod)
+			fallbackFrom, mergeMethod = mergeMethod, e.LinearHistoryMergeMethod
+		}
+	}
+	// branches are updated below if UPDATE_BRANCH is enabled.
+	if e.RequireUpToDate && !e.UpdateBranch && !e.AutoUpdateAndWait {
+		n, err := gh.behindBy(ctx, owner, repo, pr)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return nil, withReason(reasonBehindBase, fmt.Errorf("PR is %d commits behind %s; update the branch to merge", n, pr.GetBase().GetRef()))
+		}
+	}
+	checked := false
+	if e.AutoUpdateAndWait && e.RequireChecks {
+		if pr, err = gh.autoUpdateAndWait(ctx, e, pr, e.AutoUpdateGracePeriod, e.AutoUpdateStrict); err != nil {
+			return nil, err
+		}
+		checked = true
+	}
+	updated := false
+	if e.UpdateBranch && !checked {
+		if updated, err = gh.updateBranch(ctx, owner, repo, pr); err != nil {
+			return nil, err
+		}
+	}
+	if updated {
+		if err := gh.sendMsg(ctx, owner, repo, prNumber, renderMessage(e, "Updated the branch with the base branch. Merging may take a while for checks to re-run.", true, "")); err != nil {
+			logger.Warnf("failed to send message: %v", err)
+		}
+		if pr, err = gh.waitHeadUpdated(ctx, owner, repo, pr); err != nil {
+			return nil, err
+		}
+	}
+	if e.MergeabilityTimeout > 0 {
+		if pr, err = gh.waitMergeable(ctx, owner, repo, pr, e.MergeabilityTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if e.RerunChecks {
+		if err := gh.rerunChecks(ctx, e, pr, e.RerunChecksTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if e.RequireChecks && !checked {
+		// refuse before merge to avoid cryptic errors from github.
+		check := gh.checkStatus
+		if updated {
+			// checks re-run for the updated head.
+			check = gh.waitChecks
+		}
+		if err := check(ctx, owner, repo, pr); err != nil {
+			return nil, err
+		}
+	}
+	if e.RequireCheckName != "" {
+		if err := gh.waitNamedCheck(ctx, e, pr, e.RequireCheckName, e.RequireCheckTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if e.RequireDeploymentEnv != "" {
+		if err := gh.waitDeployment(ctx, e, pr, e.RequireDeploymentEnv); err != nil {
+			return nil, err
+		}
+	}
+	approved := false
+	// approve only when mergers are configured, otherwise anyone could approve via the comment.
+	// assignees allowed by ALLOW_ASSIGNEES are not mergers, so they are not approved on behalf of.
+	if e.AutoApprove && len(e.Mergers) > 0 && cmd.unauthorized == nil {
+		if approved, err = gh.autoApprove(ctx, owner, repo, pr, e.Actor); err != nil {
+			return nil, err
+		}
+	}
+	var pendingApprovals []string
+	if e.MinApprovals > 0 {
+		if err := gh.checkApprovals(ctx, owner, repo, pr, e.MinApprovals); err != nil {
+			if !waitForApproval(e, err) {
+				return nil, err
+			}
+			// github merges as soon as branch protection is satisfied, so auto merge waits only for approvals it enforces.
+			if enforced, perr := gh.enforcesApprovals(ctx, owner, repo, pr.GetBase().GetRef(), e.MinApprovals, false); perr != nil {
+				return nil, perr
+			} else if !enforced {
+				logger.Infof("branch protection of %s does not require %d approvals, refusing instead of waiting", pr.GetBase().GetRef(), e.MinApprovals)
+				return nil, err
+			}
+			pendingApprovals = append(pendingApprovals, err.Error())
+		}
+	}
+	if e.RequireCodeOwners {
+		if err := gh.checkCodeOwners(ctx, owner, repo, pr); err != nil {
+			if !waitForApproval(e, err) {
+				return nil, err
+			}
+			if enforced, perr := gh.enforcesApprovals(ctx, owner, repo, pr.GetBase().GetRef(), 0, true); perr != nil {
+				return nil, perr
+			} else if !enforced {
+				logger.Infof("branch protection of %s does not require code owner reviews, refusing instead of waiting", pr.GetBase().GetRef())
+				return nil, err
+			}
+			pendingApprovals = append(pendingApprovals, err.Error())
+		}
+	}
+	if e.RequireResolvedConversations {
+		n, err := gh.unresolvedConversations(ctx, owner, repo, prNumber)
+		if err != nil {
+			return nil, err
+		}
+		// only the count is reported not to repeat conversations.
+		if n > 0 {
+			return nil, withReason(reasonUnresolvedConversations, fmt.Errorf("%d unresolved conversations must be resolved", n))
+		}
+	}
+	autoMerge := useAutoMerge(e, pr) || len(pendingApprovals) > 0
+	// fail before generating commit messages if gh is required but missing.
+	if autoMerge {
+		if err := checkGHInstalled(); err != nil {
+			return nil, withReason(reasonInvalidConfig, err)
+		}
+	}
+	var commits []commit
+	if e.IncludeCommits || e.IncludeCoauthors {
+		max := e.MaxCommits
+		if e.IncludeCoauthors {
+			// every author is credited even if the rendered commits are truncated.
+			max = maxPRCommits
+		}
+		if commits, err = gh.listCommits(ctx, owner, repo, prNumber, max); err != nil {
+			return nil, err
+		}
+	}
+	commitMsg := cmd.message
+	if commitMsg == "" {
+		if commitMsg, err = commitMessage(pr, commits, e, mergeMethod, tpls); err != nil {
+			return nil, fmt.Errorf("failed to generate template: %w", err)
+		}
+	}
+	subject, err := generateCommitSubject(pr, tpls)
 	if err != nil {
-		return fmt.Errorf("failed to generate template: %w", err)
+		return nil, fmt.Errorf("failed to generate subject: %w", err)
+	}
+	if e.CommitMessageDiff {
+		// the diff only tells that edits took effect, so its failure does not abort the merge.
+		if err := gh.postCommitMessageDiff(ctx, owner, repo, prNumber, commitMsg); err != nil {
+			logger.Warnf("failed to post commit message diff: %v", err)
+		}
+	}
+	if e.PreviewBeforeMerge {
+		// the preview is posted before merge, so it remains for debugging if the merge fails.
+		if err := gh.sendMsg(ctx, owner, repo, prNumber, commitPreview(mergeMethod, subject, commitMsg)); err != nil {
+			logger.Warnf("failed to post commit message preview: %v", err)
+		}
 	}
 
-	if enableAutoMerge {
-		// GitHub API docs: https://cli.github.com/manual/gh_pr_merge
-		err = exec.Command("gh", "pr", "merge", strconv.Itoa(prNumber), fmt.Sprintf("--%s", mergeMethod), "--auto", "--subject", generateCommitSubject(pr), "--body", commitMsg, "--repo", fmt.Sprintf("%s/%s", owner, repo)).Run()
+	result := &mergeResult{title: pr.GetTitle(), mergeMethod: mergeMethod, fallbackFrom: fallbackFrom, headSHA: pr.GetHead().GetSHA(), commentID: e.CommentID, closedIssues: closingIssues(pr.GetBody())}
+	if !tpls.noReleaseNote {
+		result.releaseNotes = newCommitBody(pr, tpls).ReleaseNotes
+	}
+	if approved {
+		result.approvedBy = e.Actor
+	}
+	if e.CommitMessageDiff {
+		result.commitMessage = commitMsg
+	}
+	useMergeQueue := false
+	// the merge queue refuses pull requests which are not approved yet.
+	if e.UseMergeQueue && len(pendingApprovals) == 0 {
+		if useMergeQueue, err = gh.hasMergeQueue(ctx, owner, repo, pr.GetBase().GetRef()); err != nil {
+			return nil, err
+		}
+		if !useMergeQueue {
+			logger.Infof("merge queue is not configured for %s, fallback to merge", pr.GetBase().GetRef())
+		}
+	}
+	logger.Debugf("merging pull request with %s, auto merge: %t, merge queue: %t", mergeMethod, autoMerge, useMergeQueue)
+	if e.SignCommits && !useMergeQueue && !autoMerge {
+		// AUTO_MERGE_LABEL is missing on the pull request.
+		return nil, withReason(reasonInvalidConfig, fmt.Errorf("signing commits is supported only with auto merge; add label %s to sign commits", e.AutoMergeLabel))
+	}
+	if useMergeQueue {
+		err = gh.enqueue(ctx, pr)
+		result.queued, result.mergeQueue = true, true
+	} else if autoMerge {
+		err = runAutoMerge(e, prNumber, mergeMethod, subject, commitMsg)
+		result.queued, result.pendingApprovals = true, pendingApprovals
 	} else {
-		_, _, err = gh.client.PullRequests.Merge(ctx, owner, repo, prNumber, commitMsg, &github.PullRequestOptions{
-			CommitTitle: generateCommitSubject(pr),
+		if e.CommitterName != "" || e.CommitterEmail != "" {
+			logger.Warnf("committer identity is ignored since it is supported only with auto merge")
+		}
+		opt := &github.PullRequestOptions{
+			CommitTitle: subject,
 			MergeMethod: mergeMethod,
-		})
+			// the head which checks and approvals were evaluated for, so that github refuses if it has changed since then.
+			SHA: pr.GetHead().GetSHA(),
+		}
+		var mr *github.PullRequestMergeResult
+		mr, err = gh.mergePR(ctx, owner, repo, prNumber, commitMsg, opt)
+		if fallback := e.FallbackMergeMethod; err != nil && fallback != "" && fallback != mergeMethod && methodNotAllowedRegexp.MatchString(err.Error()) {
+			logger.Infof("merge method %s is not allowed, retrying merge with %s", mergeMethod, fallback)
+			// commit message generated from templates depends on the merge method.
+			if cmd.message == "" {
+				if commitMsg, err = commitMessage(pr, commits, e, fallback, tpls); err != nil {
+					return nil, fmt.Errorf("failed to generate template: %w", err)
+				}
+			}
+			if e.PreviewBeforeMerge {
+				if err := gh.sendMsg(ctx, owner, repo, prNumber, commitPreview(fallback, subject, commitMsg)); err != nil {
+					logger.Warnf("failed to post commit message preview: %v", err)
+				}
+			}
+			opt.MergeMethod = fallback
+			mr, err = gh.mergePR(ctx, owner, repo, prNumber, commitMsg, opt)
+			result.mergeMethod, result.fallbackFrom = fallback, mergeMethod
+		}
+		result.sha = mr.GetSHA()
 	}
 	if err != nil {
-		return fmt.Errorf("failed to merge pull request: %w", err)
+		err = fmt.Errorf("failed to merge pull request: %w", err)
+		if e.CommitMessageDiff {
+			err = &commitMessageError{commitMsg: commitMsg, err: err}
+		}
+		return nil, err
+	}
+	if !result.queued {
+		result.branchDeleted = gh.branchDeleted(ctx, pr)
+	}
+	return result, nil
+}
+
+// waitForApproval returns whether err refuses the merge only for missing approvals, which auto merge waits for with WAIT_FOR_APPROVAL.
+func waitForApproval(e env, err error) bool {
+	switch failureReason(err) {
+	case reasonApprovalsRequired, reasonCodeOwnersRequired:
+		return e.WaitForApproval
+	}
+	return false
+}
+
+// useAutoMerge returns whether auto merge is enabled for the pull request.
+// if AUTO_MERGE_LABEL is specified, auto merge is enabled only for pull requests with the label regardless of ENABLE_AUTO_MERGE.
+func useAutoMerge(e env, pr *github.PullRequest) bool {
+	if e.AutoMergeLabel != "" {
+		return hasLabel(pr, e.AutoMergeLabel)
+	}
+	return e.EnableAutoMerge
+}
+
+// mergePR merges the pull request via REST api.
+// merge is retried once if the base branch was modified during merge.
+func (gh *ghClient) mergePR(ctx context.Context, owner, repo string, prNumber int, commitMsg string, opt *github.PullRequestOptions) (*github.PullRequestMergeResult, error) {
+	mr, _, err := gh.client.PullRequests.Merge(ctx, owner, repo, prNumber, commitMsg, opt)
+	if err == nil || !isBaseModified(err) {
+		return mr, err
+	}
+	logger.Infof("base branch of PR #%d was modified, retrying merge", prNumber)
+	// refetch to make sure the pull request is still open before retrying.
+	if pr, _, gerr := gh.client.PullRequests.Get(ctx, owner, repo, prNumber); gerr != nil || pr.GetState() != "open" || pr.GetMerged() {
+		return nil, err
+	}
+	if mr, _, rerr := gh.client.PullRequests.Merge(ctx, owner, repo, prNumber, commitMsg, opt); rerr == nil {
+		return mr, nil
+	}
+	return nil, err
+}
+
+// runAutoMerge enables auto merge of the pull request with gh command.
+// the body is passed via a temporary file since large bodies exceed the limit of argument length.
+func runAutoMerge(e env, prNumber int, mergeMethod, subject, body string) error {
+	bodyFile, err := writeTempFile("merger-body-*.txt", body)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(bodyFile)
+	out, err := autoMergeCommand(e, prNumber, mergeMethod, subject, bodyFile).CombinedOutput()
+	if err != nil {
+		// exit status alone does not tell why gh failed.
+		return fmt.Errorf("gh pr merge failed: %w: %s", err, truncate(strings.TrimSpace(string(out)), maxCommandOutput))
+	}
+	return nil
+}
+
+// maxCommandOutput is the max length of command output included in errors.
+const maxCommandOutput = 1000
+
+// truncate returns s truncated to at most max bytes without breaking utf-8 characters.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "..."
+}
+
+// truncatedSuffix is appended to truncated comments.
+const truncatedSuffix = "…(truncated)"
+
+// truncateComment returns msg truncated to at most max bytes without breaking utf-8 characters.
+// hidden markers are moved after the suffix as far as they fit, so that the comment is still detected by them.
+func truncateComment(msg string, max int) string {
+	if max <= 0 || len(msg) <= max {
+		return msg
+	}
+	budget := max - len(truncatedSuffix)
+	markers := ""
+	for _, m := range hiddenMarkerRegexp.FindAllString(msg, -1) {
+		if len(markers)+len(m)+1 <= budget {
+			markers += "\n" + m
+		}
+	}
+	text := hiddenMarkerRegexp.ReplaceAllString(msg, "")
+	n := budget - len(markers)
+	if n < 0 {
+		n = 0
+	}
+	if len(text) <= n {
+		return text + markers
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + truncatedSuffix + markers
+}
+
+// execCommand and lookPath are replaced in tests.
+var (
+	execCommand = exec.Command
+	lookPath    = exec.LookPath
+)
+
+// checkGHInstalled returns error if gh command, which is required by auto merge, is not found.
+func checkGHInstalled() error {
+	if _, err := lookPath("gh"); err != nil {
+		return errors.New("GitHub CLI (gh) is required for auto merge but not found; install it in the runner or disable auto merge")
 	}
 	return nil
 }
 
-func generateCommitSubject(pr *github.PullRequest) string {
-	return fmt.Sprintf("%s (#%d)", pr.GetTitle(), pr.GetNumber())
+// writeTempFile writes content to a new temporary file named by pattern, and returns the path.
+func writeTempFile(pattern, content string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// autoMergeCommand returns gh command which enables auto merge of the pull request with the body read from bodyFile.
+// the subject is passed as an argument since gh has no option to read it from a file, and it is a single line anyway.
+// GitHub API docs: https://cli.github.com/manual/gh_pr_merge
+func autoMergeCommand(e env, prNumber int, mergeMethod, subject, bodyFile string) *exec.Cmd {
+	c := execCommand("gh", "pr", "merge", strconv.Itoa(prNumber), fmt.Sprintf("--%s", mergeMethod), "--auto", "--subject", subject, "--body-file", bodyFile, "--repo", fmt.Sprintf("%s/%s", e.Owner, e.Repo))
+	c.Env = append(append(os.Environ(), committerEnv(e)...), signingEnv(e)...)
+	return c
+}
+
+// committerEnv returns git environment variables to attribute commits to the committer.
+func committerEnv(e env) []string {
+	var envs []string
+	if e.CommitterName != "" {
+		envs = append(envs, "GIT_AUTHOR_NAME="+e.CommitterName, "GIT_COMMITTER_NAME="+e.CommitterName)
+	}
+	if e.CommitterEmail != "" {
+		envs = append(envs, "GIT_AUTHOR_EMAIL="+e.CommitterEmail, "GIT_COMMITTER_EMAIL="+e.CommitterEmail)
+	}
+	return envs
+}
+
+// signingEnv returns git environment variables to configure signing commits.
+// git reads GIT_CONFIG_KEY_n and GIT_CONFIG_VALUE_n as config of the command.
+func signingEnv(e env) []string {
+	if !e.SignCommits {
+		return nil
+	}
+	configs := [][2]string{{"commit.gpgsign", "true"}}
+	if e.SigningKey != "" {
+		configs = append(configs, [2]string{"user.signingkey", e.SigningKey})
+	}
+	if e.SigningFormat != "" {
+		configs = append(configs, [2]string{"gpg.format", e.SigningFormat})
+	}
+	envs := []string{fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(configs))}
+	for i, c := range configs {
+		envs = append(envs, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, c[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, c[1]))
+	}
+	return envs
+}
+
+// waitMergeable polls the pull request until github computes its mergeability, and returns the latest pull request.
+// error is returned if the pull request is not mergeable or mergeability is not computed within timeout.
+func (gh *ghClient) waitMergeable(ctx context.Context, owner, repo string, pr *github.PullRequest, timeout time.Duration) (*github.PullRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for attempt := 0; pr.Mergeable == nil; attempt++ {
+		logger.Debugf("waiting for mergeability of PR #%d", pr.GetNumber())
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("mergeability of PR #%d was not computed within %s", pr.GetNumber(), timeout)
+		case <-time.After(mergeabilityDelay(attempt, rand.Float64())):
+		}
+		var err error
+		if pr, _, err = gh.client.PullRequests.Get(ctx, owner, repo, pr.GetNumber()); err != nil {
+			return nil, fmt.Errorf("failed to get pull request: %w", err)
+		}
+	}
+	if !pr.GetMergeable() {
+		return nil, fmt.Errorf("PR #%d is not mergeable", pr.GetNumber())
+	}
+	return pr, nil
+}
+
+// mergeabilityDelay returns the delay before the attempt-th poll of mergeability.
+// the delay doubles from mergeabilityInterval up to mergeabilityMaxInterval, and jitter in [0, 1) adds up to a half of it
+// so that slow pull requests do not hammer the api.
+func mergeabilityDelay(attempt int, jitter float64) time.Duration {
+	d := mergeabilityMaxInterval
+	// avoid overflow of shift on long waits.
+	if attempt < 8 && mergeabilityInterval<<attempt < d {
+		d = mergeabilityInterval << attempt
+	}
+	return d + time.Duration(jitter*float64(d)/2)
+}
+
+// branchDeleted returns whether the head branch of the pull request no longer exists.
+func (gh *ghClient) branchDeleted(ctx context.Context, pr *github.PullRequest) bool {
+	head := pr.GetHead()
+	_, _, err := gh.client.Git.GetRef(ctx, head.GetRepo().GetOwner().GetLogin(), head.GetRepo().GetName(), "heads/"+head.GetRef())
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// mergeSummary returns markdown message of the merge result to post.
+func mergeSummary(prNumber int, r *mergeResult) string {
+	var b strings.Builder
+	switch {
+	case r.alreadyMerged:
+		fmt.Fprintf(&b, "PR #%d is already merged (by %s).\n", prNumber, r.mergedBy)
+	case r.mergeQueue:
+		fmt.Fprintf(&b, "Added PR #%d to the merge queue.\n", prNumber)
+	case len(r.pendingApprovals) > 0:
+		fmt.Fprintf(&b, "Queued PR #%d to merge automatically once it is approved.\n\n", prNumber)
+		fmt.Fprintf(&b, "- Merge method: `%s`\n", r.mergeMethod)
+		for _, p := range r.pendingApprovals {
+			fmt.Fprintf(&b, "- Pending: %s\n", p)
+		}
+	case r.queued:
+		fmt.Fprintf(&b, "Queued PR #%d to merge automatically once requirements are met.\n\n", prNumber)
+		fmt.Fprintf(&b, "- Merge method: `%s`\n", r.mergeMethod)
+	default:
+		fmt.Fprintf(&b, "Merged PR #%d successfully!\n\n", prNumber)
+		if r.fallbackFrom != "" {
+			fmt.Fprintf(&b, "- Merge method: `%s` (`%s` is not allowed)\n", r.mergeMethod, r.fallbackFrom)
+		} else {
+			fmt.Fprintf(&b, "- Merge method: `%s`\n", r.mergeMethod)
+		}
+		fmt.Fprintf(&b, "- Merge commit: %s\n", r.sha)
+		if r.branchDeleted {
+			b.WriteString("- Head branch: deleted\n")
+		} else {
+			b.WriteString("- Head branch: not deleted\n")
+		}
+		if len(r.closedIssues) > 0 {
+			issues := make([]string, len(r.closedIssues))
+			for i, n := range r.closedIssues {
+				issues[i] = fmt.Sprintf("#%d", n)
+			}
+			fmt.Fprintf(&b, "- Closed issues: %s\n", strings.Join(issues, ", "))
+		}
+		for _, n := range r.releaseNotes {
+			// notes may span lines, which would break the list.
+			fmt.Fprintf(&b, "- Release note: %s\n", strings.Join(strings.Fields(n), " "))
+		}
+	}
+	if r.approvedBy != "" {
+		fmt.Fprintf(&b, "- Approval was added on behalf of @%s\n", r.approvedBy)
+	}
+	if r.commentID != 0 {
+		b.WriteString(successMarker(r.commentID) + "\n")
+	}
+	if r.commitMessage != "" {
+		b.WriteString(commitMessageMarker(r.commitMessage) + "\n")
+	}
+	return b.String()
+}
+
+// closingIssues returns numbers of issues linked with closing keywords in body, in order of appearance without duplicates.
+func closingIssues(body string) []int {
+	var issues []int
+	seen := map[int]bool{}
+	for _, ss := range closingKeywordRegexp.FindAllStringSubmatch(body, -1) {
+		n, err := strconv.Atoi(ss[1])
+		if err != nil || seen[n] {
+			continue
+		}
+		seen[n] = true
+		issues = append(issues, n)
+	}
+	return issues
+}
+
+// openLongEnough returns how long the pull request has been open at now, and whether it is at least minMinutes.
+func openLongEnough(pr *github.PullRequest, minMinutes int, now time.Time) (time.Duration, bool) {
+	open := now.Sub(pr.GetCreatedAt())
+	// zero disables the check regardless of clock skew.
+	return open, minMinutes <= 0 || open >= time.Duration(minMinutes)*time.Minute
+}
+
+// sizeExceeded returns descriptions of the size limits which the pull request exceeds.
+// changed lines are the sum of additions and deletions. zero disables the limit.
+func sizeExceeded(pr *github.PullRequest, maxFiles, maxLines int) []string {
+	var exceeded []string
+	if files := pr.GetChangedFiles(); maxFiles > 0 && files > maxFiles {
+		exceeded = append(exceeded, fmt.Sprintf("%d files changed (allowed %d)", files, maxFiles))
+	}
+	if lines := pr.GetAdditions() + pr.GetDeletions(); maxLines > 0 && lines > maxLines {
+		exceeded = append(exceeded, fmt.Sprintf("%d lines changed (allowed %d)", lines, maxLines))
+	}
+	return exceeded
+}
+
+// labelMergeMethod returns the merge method mapped to labels of the pull request, or empty if no label is mapped.
+// labels are compared case-insensitively. multiple mapped labels are refused since the intended method is unclear.
+func labelMergeMethod(pr *github.PullRequest, methods map[string]string) (string, error) {
+	var labels []string
+	method := ""
+	for _, l := range labelNames(pr) {
+		for label, m := range methods {
+			if strings.EqualFold(l, label) {
+				labels = append(labels, l)
+				method = m
+			}
+		}
+	}
+	if len(labels) > 1 {
+		return "", withReason(reasonAmbiguousMethod, fmt.Errorf("PR has multiple merge method labels: %s; keep only one of them", strings.Join(labels, ", ")))
+	}
+	return method, nil
+}
+
+// isFork returns whether the head repository of the pull request differs from the base repository.
+// the head repository is missing if the fork is deleted, which is regarded as a fork as well.
+func isFork(pr *github.PullRequest) bool {
+	head, base := pr.GetHead().GetRepo(), pr.GetBase().GetRepo()
+	return !strings.EqualFold(head.GetOwner().GetLogin(), base.GetOwner().GetLogin()) || !strings.EqualFold(head.GetName(), base.GetName())
+}
+
+// getPullRequest returns the pull request and whether it is a draft.
+// GitHub API docs: https://docs.github.com/en/rest/pulls/pulls#get-a-pull-request
+func (gh *ghClient) getPullRequest(ctx context.Context, owner, repo string, number int) (*github.PullRequest, bool, error) {
+	// go-github does not support draft field.
+	req, err := gh.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, number), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	var pr struct {
+		github.PullRequest
+		Draft bool `json:"draft"`
+	}
+	if _, err := gh.client.Do(ctx, req, &pr); err != nil {
+		return nil, false, fmt.Errorf("failed to get pull request: %w", err)
+	}
+	return &pr.PullRequest, pr.Draft, nil
+}
+
+// blockingLabel returns the label of the pull request which is included in blockLabels.
+// labels are compared case-insensitively.
+func blockingLabel(pr *github.PullRequest, blockLabels []string) (string, bool) {
+	for _, l := range labelNames(pr) {
+		for _, b := range blockLabels {
+			if strings.EqualFold(l, b) {
+				return l, true
+			}
+		}
+	}
+	return "", false
+}
+
+// missingLabels returns requireLabels which the pull request does not have.
+// labels are compared case-insensitively.
+func missingLabels(pr *github.PullRequest, requireLabels []string) []string {
+	labels := labelNames(pr)
+	var missing []string
+	for _, r := range requireLabels {
+		found := false
+		for _, l := range labels {
+			if strings.EqualFold(l, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// hasLabel returns whether the pull request has label, ignoring case.
+func hasLabel(pr *github.PullRequest, label string) bool {
+	if label == "" {
+		return false
+	}
+	for _, l := range pr.Labels {
+		if strings.EqualFold(l.GetName(), label) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelNames returns label names of the pull request.
+func labelNames(pr *github.PullRequest) []string {
+	labels := make([]string, 0, len(pr.Labels))
+	for _, l := range pr.Labels {
+		labels = append(labels, l.GetName())
+	}
+	return labels
 }
 
-func generateCommitBody(pr *github.PullRequest) (string, error) {
-	body := newCommitBody(pr)
+// generateCommitSubject returns commit subject from the template.
+// the template receives the same fields as commit body template.
+func generateCommitSubject(pr *github.PullRequest, tpls *templates) (string, error) {
 	o := new(bytes.Buffer)
-	if err := bodyTpl.Execute(o, body); err != nil {
+	if err := tpls.subject.Execute(o, newCommitBody(pr, tpls)); err != nil {
+		return "", err
+	}
+	// subject must be a single line.
+	return strings.TrimSpace(o.String()), nil
+}
+
+// commitMessage returns commit body to merge the pull request with mergeMethod.
+// commits are rendered only by the commit body template with INCLUDE_COMMITS, and credited as co-authors of squash commits with INCLUDE_COAUTHORS.
+func commitMessage(pr *github.PullRequest, commits []commit, e env, mergeMethod string, tpls *templates) (string, error) {
+	var msg string
+	if e.SquashUsePRBody && mergeMethod == "squash" {
+		// use the pull request description without labels and release-note decoration.
+		description, _ := tpls.splitReleaseNote(sanitizeBody(pr.GetBody(), tpls.boilerplate))
+		msg = strings.TrimSpace(description)
+	} else {
+		// commits are listed for co-authors as well, while only INCLUDE_COMMITS renders them.
+		rendered := commits
+		if !e.IncludeCommits {
+			rendered = nil
+		} else if len(rendered) > e.MaxCommits {
+			rendered = rendered[:e.MaxCommits]
+		}
+		var err error
+		if msg, err = generateCommitBody(pr, rendered, tpls); err != nil {
+			return "", err
+		}
+	}
+	// github credits co-authors of squash commits only when it generates the message.
+	if e.IncludeCoauthors && mergeMethod == "squash" {
+		msg = appendTrailers(msg, coauthorTrailers(commits, pr.GetUser().GetLogin()))
+	}
+	return msg, nil
+}
+
+func generateCommitBody(pr *github.PullRequest, commits []commit, tpls *templates) (string, error) {
+	body := newCommitBody(pr, tpls)
+	body.Commits = commits
+	o := new(bytes.Buffer)
+	if err := tpls.body.Execute(o, body); err != nil {
 		return "", err
 	}
 	return o.String(), nil
 }
 
+// sendMsg posts msg to the pull request. msg is truncated to maxCommentBytes, so that the outcome is always reported.
 func (gh *ghClient) sendMsg(ctx context.Context, owner, repo string, prNumber int, msg string) error {
-	_, _, err := gh.client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{
+	_, err := gh.postComment(ctx, owner, repo, prNumber, msg)
+	return err
+}
+
+// postComment posts msg truncated to maxCommentBytes to the pull request, and returns the comment.
+func (gh *ghClient) postComment(ctx context.Context, owner, repo string, prNumber int, msg string) (*github.IssueComment, error) {
+	msg = truncateComment(msg, gh.maxCommentBytes)
+	c, _, err := gh.client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{
 		Body: &msg,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	return c, nil
+}
+
+// editComment replaces the comment with msg truncated to maxCommentBytes.
+func (gh *ghClient) editComment(ctx context.Context, owner, repo string, id int64, msg string) error {
+	msg = truncateComment(msg, gh.maxCommentBytes)
+	if _, _, err := gh.client.Issues.EditComment(ctx, owner, repo, id, &github.IssueComment{Body: &msg}); err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
 	}
 	return nil
 }
 
-func newCommitBody(pr *github.PullRequest) commitBody {
-	labels := make([]string, 0, len(pr.Labels))
-	for _, l := range pr.Labels {
-		labels = append(labels, l.GetName())
+// sendResult posts the result message on the pull request. successes are not posted with quiet success.
+// re-delivered events are not detected by the success marker then, but merged pull requests are reported as already merged without posting.
+func (gh *ghClient) sendResult(ctx context.Context, e env, msg string, succeeded bool) error {
+	if succeeded && e.QuietSuccess {
+		return nil
+	}
+	return gh.sendMsg(ctx, e.Owner, e.Repo, e.PRNumber, renderMessage(e, msg, succeeded, ""))
+}
+
+// newCommitBody returns fields of commit message templates.
+// the pull request body is sanitized before extracting release notes, so that release-note blocks in comments are ignored.
+func newCommitBody(pr *github.PullRequest, tpls *templates) commitBody {
+	labels := labelNames(pr)
+	description, releaseNotes := tpls.splitReleaseNote(sanitizeBody(pr.GetBody(), tpls.boilerplate))
+	if tpls.quoteDescription {
+		description = quote(description)
 	}
-	description, releaseNote := splitReleaseNote(pr.GetBody())
 	return commitBody{
-		Message:     description,
-		Labels:      labels,
-		ReleaseNote: releaseNote,
+		Message:             description,
+		Labels:              ignoreLabels(labels, tpls.labelIgnore),
+		ReleaseNote:         strings.Join(releaseNotes, "\n"),
+		ReleaseNotes:        releaseNotes,
+		ReleaseNoteCategory: releaseNoteCategory(labels, tpls.categories),
+		Author:              pr.GetUser().GetLogin(),
+		Number:              pr.GetNumber(),
+		Title:               pr.GetTitle(),
+		LabelStyle:          tpls.labelStyle,
 	}
 }
 
 type commitBody struct {
-	Labels      []string
-	Message     string
-	ReleaseNote string
+	Labels  []string
+	Message string
+	// ReleaseNote is ReleaseNotes joined with newlines, kept for templates written before multiple release notes.
+	ReleaseNote  string
+	ReleaseNotes []string
+	// ReleaseNoteCategory is the category mapped from labels by LABEL_CATEGORY_MAP, empty if no label is mapped.
+	ReleaseNoteCategory string
+	Author              string
+	Number              int
+	Title               string
+	// Commits are commits of the pull request, only set with INCLUDE_COMMITS.
+	Commits []commit
+	// LabelStyle is LABEL_STYLE, which the built-in template renders labels with.
+	LabelStyle string
 }
 
+const (
+	labelStyleList   = "list"
+	labelStyleInline = "inline"
+	labelStyleNone   = "none"
+)
+
 var bodyTpl = template.Must(template.New("commit").Parse(`
 {{- if .Message }}
 {{ .Message }}
 {{- end }}
-{{if .Labels}}
+{{if and .Labels (ne .LabelStyle "none")}}
+{{- if eq .LabelStyle "inline" }}
+Labels: {{ range $i, $l := .Labels }}{{ if $i }}, {{ end }}{{ $l }}{{ end }}
+{{- else }}
 Labels:
 {{- range .Labels }}
   * {{ . }}
 {{- end -}}
 {{- end -}}
-` +
-	"\n\n```release-note\n* {{ .ReleaseNote }}\n```",
+{{- end -}}
+{{- if .Commits }}
+
+Commits:
+{{- range .Commits }}
+  * {{ .SHA }} {{ .Message }}
+{{- end -}}
+{{- end -}}
+{{- if .ReleaseNotes -}}
+{{ "\n" }}` +
+	"```release-note{{ with .ReleaseNoteCategory }}-{{ . }}{{ end }}\n{{ range .ReleaseNotes }}* {{ . }}\n{{ end }}```" +
+	"{{ end }}",
 ))
 
+// sampleCommitBody is used to validate templates before merge.
+var sampleCommitBody = commitBody{
+	Labels:              []string{"label"},
+	Message:             "message",
+	ReleaseNote:         "NONE",
+	ReleaseNotes:        []string{"NONE"},
+	ReleaseNoteCategory: "feature",
+	Author:              "author",
+	Number:              1,
+	Title:               "title",
+	Commits:             []commit{{SHA: "sha", Message: "message"}},
+}
+
+var subjectTpl = template.Must(template.New("subject").Parse("{{ .Title }} (#{{ .Number }})"))
+
+// templates are commit message templates loaded from env.
+type templates struct {
+	body    *template.Template
+	subject *template.Template
+	// boilerplate matches lines of pull request template removed from commit messages.
+	boilerplate []*regexp.Regexp
+	// categories maps labels to release note categories.
+	categories map[string]string
+	// noReleaseNote disables release notes, then the pull request body is used as is.
+	noReleaseNote bool
+	// labelIgnore matches labels omitted from commit messages.
+	labelIgnore []*regexp.Regexp
+	// quoteDescription renders the pull request description as a markdown blockquote.
+	quoteDescription bool
+	// releaseNoteFence is the language of fenced code blocks of release notes. default is release-note.
+	releaseNoteFence string
+	// releaseNoteStrip matches lines removed from release notes. the description is not affected.
+	releaseNoteStrip *regexp.Regexp
+	// labelStyle is how the built-in template renders labels. empty is list.
+	labelStyle string
+}
+
+// splitReleaseNote splits release notes from body unless release notes are disabled.
+func (t *templates) splitReleaseNote(body string) (string, []string) {
+	if t.noReleaseNote {
+		return body, nil
+	}
+	fence := t.releaseNoteFence
+	if fence == "" {
+		fence = defaultReleaseNoteFence
+	}
+	description, releaseNotes := splitReleaseNote(body, fence)
+	if t.releaseNoteStrip == nil {
+		return description, releaseNotes
+	}
+	var stripped []string
+	for _, rn := range releaseNotes {
+		if s := stripLines(rn, t.releaseNoteStrip); s != "" {
+			stripped = append(stripped, s)
+		}
+	}
+	if len(stripped) == 0 {
+		return description, []string{"NONE"}
+	}
+	return description, stripped
+}
+
+// stripLines removes lines matching re from s.
+func stripLines(s string, re *regexp.Regexp) string {
+	var kept []string
+	for _, l := range strings.Split(s, "\n") {
+		if !re.MatchString(l) {
+			kept = append(kept, l)
+		}
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// loadTemplates parses templates from env, falling back to built-in templates.
+// COMMIT_BODY_TEMPLATE takes precedence over COMMIT_BODY_TEMPLATE_FILE.
+func loadTemplates(e env) (*templates, error) {
+	tpls := &templates{body: bodyTpl, subject: subjectTpl}
+	if e.SubjectTemplate != "" {
+		tpl, err := template.New("subject").Parse(e.SubjectTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse commit subject template: %w", err)
+		}
+		// execute with sample fields to detect references to unknown fields before merge.
+		if err := tpl.Execute(io.Discard, sampleCommitBody); err != nil {
+			return nil, fmt.Errorf("invalid commit subject template: %w", err)
+		}
+		tpls.subject = tpl
+	}
+	text := e.BodyTemplate
+	if text == "" && e.BodyTemplateFile != "" {
+		b, err := os.ReadFile(e.BodyTemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit body template file: %w", err)
+		}
+		text = string(b)
+	}
+	if text != "" {
+		tpl, err := template.New("commit").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse commit body template: %w", err)
+		}
+		tpls.body = tpl
+	}
+	if e.MessageTemplate != "" {
+		if _, err := parseMessageTemplate(e.MessageTemplate); err != nil {
+			return nil, fmt.Errorf("invalid message template: %w", err)
+		}
+	}
+	tpls.categories = e.LabelCategories
+	tpls.noReleaseNote = !e.ReleaseNote
+	tpls.quoteDescription = e.QuoteDescription
+	tpls.releaseNoteFence = e.ReleaseNoteFence
+	tpls.labelStyle = e.LabelStyle
+	for _, g := range e.LabelIgnore {
+		tpls.labelIgnore = append(tpls.labelIgnore, labelGlobRegexp(g))
+	}
+	if e.ReleaseNoteStrip != "" {
+		re, err := regexp.Compile(e.ReleaseNoteStrip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid release note strip pattern: %w", err)
+		}
+		tpls.releaseNoteStrip = re
+	}
+	for _, p := range e.BoilerplatePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boilerplate pattern: %w", err)
+		}
+		tpls.boilerplate = append(tpls.boilerplate, re)
+	}
+	return tpls, nil
+}
+
 var (
-	needApproveRegexp = regexp.MustCompile("At least ([0-9]+) approving review is required by reviewers with write access")
-	releaseNoteRegexp = regexp.MustCompile("```release-note\n(.+?)\n```")
+	needApproveRegexp  = regexp.MustCompile("At least ([0-9]+) approving review is required by reviewers with write access")
+	conflictRegexp     = regexp.MustCompile(`(?i)merge conflicts?|is not mergeable`)
+	baseModifiedRegexp = regexp.MustCompile("Base branch was modified")
+	headModifiedRegexp = regexp.MustCompile("Head branch was modified")
+	// messageOverrideRegexp matches the commit message following the command.
+	messageOverrideRegexp = regexp.MustCompile(`(?s)\s+message:(.*)$`)
+	// prNumbersRegexp matches pull request numbers at the end of the command.
+	prNumbersRegexp = regexp.MustCompile(`(?:\s+#[0-9]+)+$`)
+	// targetRegexp matches the pull request of another repository at the end of the command .e.g. /merge owner/repo#123
+	targetRegexp = regexp.MustCompile(`\s+([A-Za-z0-9][A-Za-z0-9-]*)/([A-Za-z0-9._-]+)#([0-9]+)$`)
+	// methodNotAllowedRegexp matches errors of merge methods disabled in the repository .e.g. Squash merges are not allowed on this repository.
+	methodNotAllowedRegexp = regexp.MustCompile("(?:merges|commits) are not allowed on this repository")
+	// closingKeywordRegexp matches keywords linking issues to close .e.g. Closes #123, fixes: #456
+	// GitHub docs: https://docs.github.com/en/issues/tracking-your-work-with-issues/linking-a-pull-request-to-an-issue#linking-a-pull-request-to-an-issue-using-a-keyword
+	closingKeywordRegexp = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+#([0-9]+)\b`)
+	// htmlCommentLineRegexp matches html comments occupying whole lines, which are removed with the lines.
+	htmlCommentLineRegexp = regexp.MustCompile(`(?m)^[ \t]*<!--(?s:.*?)-->[ \t]*(?:\n|$)`)
+	htmlCommentRegexp     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// secondaryRateLimitRegexp matches errors of the secondary rate limit .e.g. You have exceeded a secondary rate limit.
+	secondaryRateLimitRegexp = regexp.MustCompile(`(?i)secondary rate limit|abuse detection`)
 )
 
-// errMsg returns error message to post from error.
+// hasStatus returns whether err is an error response from github with any of the status codes.
+func hasStatus(err error, codes ...int) bool {
+	var gerr *github.ErrorResponse
+	if !errors.As(err, &gerr) || gerr.Response == nil {
+		return false
+	}
+	for _, c := range codes {
+		if gerr.Response.StatusCode == c {
+			return true
+		}
+	}
+	return false
+}
+
+// errMsg returns error message to post from error. trigger is the comment suggested to retry.
 // Especially handing error from github. go-github does not have error type for some cases.
-func errMsg(err error) string {
+func errMsg(err error, trigger string) string {
 	if err == nil {
 		return "Succeeded!"
 	}
+	var rerr *github.RateLimitError
+	if errors.As(err, &rerr) {
+		return fmt.Sprintf("GitHub API rate limit hit; resets at %s.", rerr.Rate.Reset.UTC().Format("2006-01-02 15:04:05 MST"))
+	}
+	var aerr *github.AbuseRateLimitError
+	if errors.As(err, &aerr) && aerr.RetryAfter != nil {
+		return fmt.Sprintf("Hit GitHub abuse detection; retrying after %s.", aerr.GetRetryAfter())
+	}
+	if isAbuseRateLimit(err) {
+		return "Hit GitHub abuse detection; retrying later."
+	}
+	var uerr *unauthorizedError
+	if errors.As(err, &uerr) {
+		return uerr.message()
+	}
 	ss := needApproveRegexp.FindStringSubmatch(err.Error())
 	if len(ss) == 2 {
 		return fmt.Sprintf("Need %s approving review", ss[1])
 	}
+	if isConflict(err) {
+		return "This PR has merge conflicts and cannot be merged."
+	}
+	if headModifiedRegexp.MatchString(err.Error()) {
+		return "Branch changed since checks passed; re-run required."
+	}
+	if isBaseModified(err) {
+		return fmt.Sprintf("The base branch was modified during merge. Please try `%s` again.", trigger)
+	}
+	var reerr *reasonError
+	if errors.As(err, &reerr) {
+		return sentence(err.Error())
+	}
 	return err.Error()
 }
 
-// splitReleaseNote returns description and release note from commit body.
+// sentence returns s capitalized and ending with a period, so that refusals read as sentences in comments.
+func sentence(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	s = string(unicode.ToUpper(r)) + s[n:]
+	if !strings.ContainsAny(s[len(s)-1:], ".!?") {
+		s += "."
+	}
+	return s
+}
+
+// isAbuseRateLimit returns whether err is the secondary rate limit of github, formerly called abuse detection.
+// go-github detects it by the documentation url, which github has changed since then, so the message is also checked.
+func isAbuseRateLimit(err error) bool {
+	var aerr *github.AbuseRateLimitError
+	if errors.As(err, &aerr) {
+		return true
+	}
+	return hasStatus(err, http.StatusForbidden) && secondaryRateLimitRegexp.MatchString(err.Error())
+}
+
+// isConflict returns whether err is caused by merge conflicts.
+// status code is inspected if err is an error response from github.
+func isConflict(err error) bool {
+	var gerr *github.ErrorResponse
+	if errors.As(err, &gerr) && gerr.Response != nil {
+		status := gerr.Response.StatusCode
+		return (status == http.StatusMethodNotAllowed || status == http.StatusConflict) && conflictRegexp.MatchString(gerr.Message)
+	}
+	return conflictRegexp.MatchString(err.Error())
+}
+
+// isBaseModified returns whether err is caused by the base branch modified during merge.
+func isBaseModified(err error) bool {
+	return baseModifiedRegexp.MatchString(err.Error())
+}
+
+// quote returns s as a markdown blockquote. CRLF is converted to LF.
+// empty lines are quoted to keep paragraphs in a blockquote, except a trailing newline.
+func quote(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		switch {
+		case l != "":
+			lines[i] = "> " + l
+		case i < len(lines)-1:
+			lines[i] = ">"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ignoreLabels returns labels which do not match any of ignore.
+// labels are ignored only in commit messages, so release note categories are still mapped from them.
+func ignoreLabels(labels []string, ignore []*regexp.Regexp) []string {
+	if len(ignore) == 0 {
+		return labels
+	}
+	kept := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !matchAny(ignore, l) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// labelGlobRegexp converts glob into regexp matching whole label names, ignoring case.
+// unlike globs of paths, `*` matches any characters including `/` and `?` matches any character, since labels are not paths.
+func labelGlobRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// releaseNoteCategory returns the category of the first label mapped by categories, ignoring case.
+func releaseNoteCategory(labels []string, categories map[string]string) string {
+	for _, l := range labels {
+		for label, category := range categories {
+			if strings.EqualFold(l, label) {
+				return category
+			}
+		}
+	}
+	return ""
+}
+
+// sanitizeBody removes html comments and lines matching boilerplate left by pull request templates.
+func sanitizeBody(body string, boilerplate []*regexp.Regexp) string {
+	body = htmlCommentLineRegexp.ReplaceAllString(body, "")
+	body = htmlCommentRegexp.ReplaceAllString(body, "")
+	if len(boilerplate) == 0 {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if !matchAny(boilerplate, l) {
+			kept = append(kept, l)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultReleaseNoteFence is the language of release-note blocks.
+const defaultReleaseNoteFence = "release-note"
+
+// splitReleaseNote returns description and release notes from commit body.
+// every block fenced with fence language is stripped from description.
 // if release note is empty, return whole body and "NONE"
-func splitReleaseNote(body string) (description, releaseNote string) {
-	ss := releaseNoteRegexp.FindStringSubmatch(body)
-	if len(ss) != 2 {
-		return body, "NONE"
+func splitReleaseNote(body, fence string) (description string, releaseNotes []string) {
+	description = body
+	// fence is quoted since it is configured by users. notes may span lines.
+	re := regexp.MustCompile("(?s)```" + regexp.QuoteMeta(fence) + "\n(.+?)\n```")
+	for _, ss := range re.FindAllStringSubmatch(body, -1) {
+		if rn := strings.TrimSpace(ss[1]); rn != "" {
+			releaseNotes = append(releaseNotes, rn)
+		}
+		description = strings.ReplaceAll(description, ss[0], "")
 	}
-	if rn := strings.TrimSpace(ss[1]); rn != "" {
-		return strings.ReplaceAll(body, ss[0], ""), rn
+	if len(releaseNotes) == 0 {
+		return body, []string{"NONE"}
 	}
-	return body, "NONE"
+	return description, releaseNotes
 }
@@ -1,15 +1,34 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/google/go-github/github"
 )
 
 func Test_ghClient_generateCommitBody(t *testing.T) {
 	type args struct {
-		pr *github.PullRequest
+		pr            *github.PullRequest
+		commits       []commit
+		categories    map[string]string
+		noReleaseNote bool
+		labelStyle    string
 	}
 	tests := []struct {
 		name    string
@@ -38,7 +57,7 @@ pull request body
 Labels:
   * label1
   * label2` +
-				"```release-note\n" +
+				"\n```release-note\n" +
 				"* NONE\n" +
 				"```",
 			wantErr: false,
@@ -52,7 +71,7 @@ Labels:
 			},
 			want: `
 pull request body
-` + "```release-note\n* NONE\n```",
+` + "\n```release-note\n* NONE\n```",
 			wantErr: false,
 		},
 		{
@@ -65,13 +84,110 @@ pull request body
 			want: `
 pull request body
 ` +
-				"\n```release-note\n* This is greate a release!!!\n```",
+				"\n\n```release-note\n* This is greate a release!!!\n```",
+			wantErr: false,
+		},
+		{
+			name: "with multiple release-notes",
+			args: args{
+				pr: &github.PullRequest{
+					Body: github.String("pull request body\n```release-note\nfirst change\n```\n```release-note\nsecond change\n```"),
+				},
+			},
+			want: `
+pull request body
+
+` +
+				"\n\n```release-note\n* first change\n* second change\n```",
+			wantErr: false,
+		},
+		{
+			name: "release note disabled",
+			args: args{
+				pr: &github.PullRequest{
+					Body: github.String("pull request body\n```release-note\nkept as is\n```"),
+					Labels: []*github.Label{
+						{Name: github.String("label1")},
+					},
+				},
+				noReleaseNote: true,
+			},
+			want:    "\npull request body\n```release-note\nkept as is\n```\n\nLabels:\n  * label1",
+			wantErr: false,
+		},
+		{
+			name: "inline labels",
+			args: args{
+				pr: &github.PullRequest{
+					Body: github.String("pull request body"),
+					Labels: []*github.Label{
+						{Name: github.String("label1")},
+						{Name: github.String("label2")},
+					},
+				},
+				noReleaseNote: true,
+				labelStyle:    labelStyleInline,
+			},
+			want:    "\npull request body\n\nLabels: label1, label2",
+			wantErr: false,
+		},
+		{
+			name: "no labels",
+			args: args{
+				pr: &github.PullRequest{
+					Body: github.String("pull request body"),
+					Labels: []*github.Label{
+						{Name: github.String("label1")},
+					},
+				},
+				noReleaseNote: true,
+				labelStyle:    labelStyleNone,
+			},
+			want:    "\npull request body\n",
+			wantErr: false,
+		},
+		{
+			name: "with release note category",
+			args: args{
+				pr: &github.PullRequest{
+					Body: github.String("pull request body\n```release-note\nAdd a feature\n```"),
+					Labels: []*github.Label{
+						{Name: github.String("kind/feature")},
+					},
+				},
+				categories: map[string]string{"kind/feature": "feature"},
+			},
+			want: `
+pull request body
+
+
+Labels:
+  * kind/feature` +
+				"\n```release-note-feature\n* Add a feature\n```",
+			wantErr: false,
+		},
+		{
+			name: "with commits",
+			args: args{
+				pr: &github.PullRequest{
+					Body: github.String("pull request body"),
+				},
+				commits: []commit{{SHA: "a1", Message: "first"}, {SHA: "b2", Message: "second"}},
+			},
+			want: `
+pull request body
+
+
+Commits:
+  * a1 first
+  * b2 second` +
+				"\n```release-note\n* NONE\n```",
 			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := generateCommitBody(tt.args.pr)
+			got, err := generateCommitBody(tt.args.pr, tt.args.commits, &templates{body: bodyTpl, categories: tt.args.categories, noReleaseNote: tt.args.noReleaseNote, labelStyle: tt.args.labelStyle})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ghClient.generateCommitMessage() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -85,7 +201,8 @@ pull request body
 
 func Test_generateCommitSubject(t *testing.T) {
 	type args struct {
-		pr *github.PullRequest
+		pr  *github.PullRequest
+		tpl *template.Template
 	}
 	tests := []struct {
 		name string
@@ -99,19 +216,96 @@ func Test_generateCommitSubject(t *testing.T) {
 					Title:  github.String("pull request title"),
 					Number: github.Int(1),
 				},
+				tpl: subjectTpl,
 			},
 			want: "pull request title (#1)",
 		},
+		{
+			name: "conventional commit subject",
+			args: args{
+				pr: &github.PullRequest{
+					Title:  github.String("pull request title"),
+					Number: github.Int(1),
+					User:   &github.User{Login: github.String("0daryo")},
+					Labels: []*github.Label{
+						{Name: github.String("feat")},
+					},
+				},
+				tpl: template.Must(template.New("subject").Parse("{{ index .Labels 0 }}: {{ .Title }} by @{{ .Author }}\n")),
+			},
+			want: "feat: pull request title by @0daryo",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := generateCommitSubject(tt.args.pr); got != tt.want {
+			got, err := generateCommitSubject(tt.args.pr, &templates{subject: tt.args.tpl})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
 				t.Errorf("generateCommitSubject() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func Test_validateRequired(t *testing.T) {
+	valid := env{GithubToken: "token", Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}
+	tests := []struct {
+		name    string
+		modify  func(e *env)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			modify: func(e *env) {},
+		},
+		{
+			name:    "missing owner",
+			modify:  func(e *env) { e.Owner = "" },
+			wantErr: "owner is required",
+		},
+		{
+			name:    "missing repo",
+			modify:  func(e *env) { e.Repo = "" },
+			wantErr: "repo is required",
+		},
+		{
+			name:    "missing github token",
+			modify:  func(e *env) { e.GithubToken = "" },
+			wantErr: "github_token is required unless app_id is specified",
+		},
+		{
+			name:   "github app instead of github token",
+			modify: func(e *env) { e.GithubToken, e.AppID = "", 1 },
+		},
+		{
+			name:    "missing pr number",
+			modify:  func(e *env) { e.PRNumber = 0 },
+			wantErr: "pr_number must be a positive number, got 0",
+		},
+		{
+			name:    "negative pr number",
+			modify:  func(e *env) { e.PRNumber = -1 },
+			wantErr: "pr_number must be a positive number, got -1",
+		},
+		{
+			name:   "self test without pr number",
+			modify: func(e *env) { e.PRNumber, e.SelfTest = 0, true },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := valid
+			tt.modify(&e)
+			err := validateRequired(e)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("validateRequired() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_validateEnv(t *testing.T) {
 	type args struct {
 		e env
@@ -121,13 +315,211 @@ func Test_validateEnv(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
+		{
+			name: "squash",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "squash",
+				},
+			},
+		},
+		{
+			name: "rebase",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "rebase",
+				},
+			},
+		},
+		{
+			name: "invalid merge method",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "sqush",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "review comment",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					CommentSource:  "review",
+				},
+			},
+		},
+		{
+			name: "invalid comment source",
+			args: args{
+				e: env{
+					Comment:        "not a command",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					CommentSource:  "discussion",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid linear history merge method",
+			args: args{
+				e: env{
+					Comment:                  "/merge",
+					TriggerComment:           "/merge",
+					MergeMethod:              "merge",
+					LinearHistoryMergeMethod: "merge",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid fallback merge method",
+			args: args{
+				e: env{
+					Comment:             "/merge",
+					TriggerComment:      "/merge",
+					MergeMethod:         "squash",
+					FallbackMergeMethod: "marge",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid label merge method",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "squash",
+					LabelMethods:   labelMethodMap{"squash-me": "squish"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "sign commits with auto merge",
+			args: args{
+				e: env{
+					Comment:         "/merge",
+					TriggerComment:  "/merge",
+					MergeMethod:     "merge",
+					SignCommits:     true,
+					EnableAutoMerge: true,
+				},
+			},
+		},
+		{
+			name: "sign commits without auto merge",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					SignCommits:    true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid label style",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					LabelStyle:     "table",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid target repo",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					TargetRepos:    []string{"abema"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid empty mergers policy",
+			args: args{
+				e: env{
+					Comment:            "/merge",
+					TriggerComment:     "/merge",
+					MergeMethod:        "merge",
+					EmptyMergersPolicy: "ask",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid ack style",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					AckStyle:       "emoji",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "auto update and wait without require checks",
+			args: args{
+				e: env{
+					Comment:           "/merge",
+					TriggerComment:    "/merge",
+					MergeMethod:       "merge",
+					AutoUpdateAndWait: true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty merge method",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid merge method of command",
+			args: args{
+				e: env{
+					Comment:        "/squash",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					Commands:       commandMap{"/squash": "squash-merge"},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "valid env",
 			args: args{
 				e: env{
-					Comment: "/merge",
-					Mergers: []string{"0daryo"},
-					Actor:   "0daryo",
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					Mergers:        []string{"0daryo"},
+					Actor:          "0daryo",
 				},
 			},
 		},
@@ -135,28 +527,39 @@ func Test_validateEnv(t *testing.T) {
 			name: "invalid comment",
 			args: args{
 				e: env{
-					Comment: "/approve",
-					Mergers: []string{"0daryo"},
-					Actor:   "0daryo",
+					Comment:        "/approve",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					Mergers:        []string{"0daryo"},
+					Actor:          "0daryo",
 				},
 			},
 			wantErr: true,
 		},
 		{
-			name: "actor is not merger",
+			name: "comment with trailing newline",
 			args: args{
 				e: env{
-					Comment: "/merge",
-					Mergers: []string{"0daryo"},
-					Actor:   "github",
+					Comment:        "/merge\n",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+				},
+			},
+		},
+		{
+			name: "custom trigger comment",
+			args: args{
+				e: env{
+					Comment:        "/ship-it",
+					TriggerComment: "/ship-it",
+					MergeMethod:    "merge",
 				},
 			},
-			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := validateEnv(tt.args.e); (err != nil) != tt.wantErr {
+			if _, err := validateEnv(tt.args.e); (err != nil) != tt.wantErr {
 				t.Errorf("validateEnv() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -164,8 +567,10 @@ func Test_validateEnv(t *testing.T) {
 }
 
 func Test_errMsg(t *testing.T) {
+	retryAfter := 90 * time.Second
 	type args struct {
-		err error
+		err     error
+		trigger string
 	}
 	tests := []struct {
 		name string
@@ -191,52 +596,2800 @@ func Test_errMsg(t *testing.T) {
 			},
 			want: "internal server error",
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := errMsg(tt.args.err); got != tt.want {
-				t.Errorf("errMsg() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func Test_splitReleaseNote(t *testing.T) {
-	type args struct {
-		body string
-	}
-	tests := []struct {
-		name            string
-		args            args
-		wantDescription string
-		wantReleaseNote string
-	}{
 		{
-			name: "release note description",
+			name: "rate limit",
 			args: args{
-				body: "release note description ```release-note\nThis is great release!!!\n```",
+				err: fmt.Errorf("failed to get pull request: %w", &github.RateLimitError{
+					Rate: github.Rate{
+						Limit: 5000,
+						Reset: github.Timestamp{Time: time.Date(2023, 1, 2, 12, 4, 5, 0, time.FixedZone("JST", 9*60*60))},
+					},
+					Message: "API rate limit exceeded",
+				}),
 			},
-			wantDescription: "release note description ",
-			wantReleaseNote: "This is great release!!!",
+			want: "GitHub API rate limit hit; resets at 2023-01-02 03:04:05 UTC.",
 		},
 		{
-			name: "no releaes note",
+			name: "abuse rate limit with retry after",
 			args: args{
-				body: "release note description",
+				err: fmt.Errorf("failed to merge pull request: %w", &github.AbuseRateLimitError{
+					Message:    "You have triggered an abuse detection mechanism.",
+					RetryAfter: &retryAfter,
+				}),
 			},
-			wantDescription: "release note description",
-			wantReleaseNote: "NONE",
+			want: "Hit GitHub abuse detection; retrying after 1m30s.",
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			gotDescription, gotReleaseNote := splitReleaseNote(tt.args.body)
-			if gotDescription != tt.wantDescription {
-				t.Errorf("splitReleaseNote() gotDescription = %v, want %v", gotDescription, tt.wantDescription)
-			}
-			if gotReleaseNote != tt.wantReleaseNote {
-				t.Errorf("splitReleaseNote() gotReleaseNote = %v, want %v", gotReleaseNote, tt.wantReleaseNote)
-			}
-		})
+		{
+			name: "abuse rate limit without retry after",
+			args: args{
+				err: &github.AbuseRateLimitError{Message: "You have triggered an abuse detection mechanism."},
+			},
+			want: "Hit GitHub abuse detection; retrying later.",
+		},
+		{
+			name: "secondary rate limit error response",
+			args: args{
+				err: errorResponse(http.StatusForbidden, "You have exceeded a secondary rate limit. Please wait a few minutes before you try again."),
+			},
+			want: "Hit GitHub abuse detection; retrying later.",
+		},
+		{
+			name: "merge conflict error response",
+			args: args{
+				err: fmt.Errorf("failed to merge pull request: %w", errorResponse(http.StatusMethodNotAllowed, "Pull Request is not mergeable")),
+			},
+			want: "This PR has merge conflicts and cannot be merged.",
+		},
+		{
+			name: "not mergeable error response with other status",
+			args: args{
+				err: errorResponse(http.StatusUnprocessableEntity, "Pull Request is not mergeable"),
+			},
+			want: "PUT https://api.github.com/repos/abema/github-actions-merger/pulls/1/merge: 422 Pull Request is not mergeable []",
+		},
+		{
+			name: "merge conflict string",
+			args: args{
+				err: errors.New("failed to merge pull request: 405 Pull Request has merge conflicts"),
+			},
+			want: "This PR has merge conflicts and cannot be merged.",
+		},
+		{
+			name: "actor not in mergers",
+			args: args{
+				err: &unauthorizedError{actor: "octocat", mergers: []string{"na-ga", "team:core-reviewers"}},
+			},
+			want: "@octocat is not allowed to merge this PR. Allowed mergers: @na-ga, members of team `core-reviewers`. Please ask one of them to merge.",
+		},
+		{
+			name: "actor not in org teams",
+			args: args{
+				err: &unauthorizedError{actor: "octocat", mergers: []string{"org:platform", "org:other-org/platform"}},
+			},
+			want: "@octocat is not allowed to merge this PR. Allowed mergers: members of team `platform`, members of team `other-org/platform`. Please ask one of them to merge.",
+		},
+		{
+			name: "actor lacks write access",
+			args: args{
+				err: &unauthorizedError{actor: "octocat"},
+			},
+			want: "@octocat is not allowed to merge this PR since write access to the repository is required. Please contact a maintainer.",
+		},
+		{
+			name: "no mergers configured",
+			args: args{
+				err: &unauthorizedError{actor: "octocat", noMergers: true},
+			},
+			want: "@octocat is not allowed to merge this PR since no mergers are configured. Please contact a maintainer.",
+		},
+		{
+			name: "actor not in mergers nor assignees",
+			args: args{
+				err: &unauthorizedError{actor: "octocat", mergers: []string{"na-ga"}, assignees: true},
+			},
+			want: "@octocat is not allowed to merge this PR. Allowed mergers: @na-ga. Assignees of this PR are also allowed. Please ask one of them to merge.",
+		},
+		{
+			name: "head branch modified",
+			args: args{
+				err: fmt.Errorf("failed to merge pull request: %w", errorResponse(http.StatusConflict, "Head branch was modified. Review and try the merge again.")),
+			},
+			want: "Branch changed since checks passed; re-run required.",
+		},
+		{
+			name: "base branch modified",
+			args: args{
+				err: fmt.Errorf("failed to merge pull request: %w", errorResponse(http.StatusConflict, "Base branch was modified. Review and try the merge again.")),
+			},
+			want: "The base branch was modified during merge. Please try `/merge` again.",
+		},
+		{
+			name: "base branch modified with custom trigger",
+			args: args{
+				err:     fmt.Errorf("failed to merge pull request: %w", errorResponse(http.StatusConflict, "Base branch was modified. Review and try the merge again.")),
+				trigger: "/ship",
+			},
+			want: "The base branch was modified during merge. Please try `/ship` again.",
+		},
+		{
+			name: "refusal",
+			args: args{
+				err: withReason(reasonDraft, errors.New("cannot merge a draft PR; mark it ready for review first")),
+			},
+			want: "Cannot merge a draft PR; mark it ready for review first.",
+		},
+		{
+			name: "refusal starting with an acronym",
+			args: args{
+				err: withReason(reasonFork, errors.New("PR is from a fork; add label fork-ok to merge")),
+			},
+			want: "PR is from a fork; add label fork-ok to merge.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger := tt.args.trigger
+			if trigger == "" {
+				trigger = "/merge"
+			}
+			if got := errMsg(tt.args.err, trigger); got != tt.want {
+				t.Errorf("errMsg() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sanitizeBody(t *testing.T) {
+	body := `## What
+<!-- Describe what this pull request changes. -->
+Add option to update branch.
+
+## Why
+<!--
+Link the issue.
+-->
+Fixes #32 <!-- required -->
+
+## Checklist
+- [ ] Tests added
+` + "<!--\n```release-note\nplaceholder\n```\n-->\n```release-note\nAdd update_branch.\n```"
+	tests := []struct {
+		name        string
+		boilerplate []*regexp.Regexp
+		want        string
+	}{
+		{
+			name: "html comments",
+			want: "## What\nAdd option to update branch.\n\n## Why\nFixes #32 \n\n## Checklist\n- [ ] Tests added\n```release-note\nAdd update_branch.\n```",
+		},
+		{
+			name:        "boilerplate",
+			boilerplate: []*regexp.Regexp{regexp.MustCompile(`^## `), regexp.MustCompile(`^- \[ \]`)},
+			want:        "Add option to update branch.\n\nFixes #32 \n\n```release-note\nAdd update_branch.\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeBody(body, tt.boilerplate); got != tt.want {
+				t.Errorf("sanitizeBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	// release notes in comments are not extracted.
+	if _, notes := splitReleaseNote(sanitizeBody(body, nil), "release-note"); !reflect.DeepEqual(notes, []string{"Add update_branch."}) {
+		t.Errorf("release notes = %v, want only notes outside comments", notes)
+	}
+}
+
+func Test_splitReleaseNote(t *testing.T) {
+	type args struct {
+		body  string
+		fence string
+	}
+	tests := []struct {
+		name             string
+		args             args
+		wantDescription  string
+		wantReleaseNotes []string
+	}{
+		{
+			name: "release note description",
+			args: args{
+				body: "release note description ```release-note\nThis is great release!!!\n```",
+			},
+			wantDescription:  "release note description ",
+			wantReleaseNotes: []string{"This is great release!!!"},
+		},
+		{
+			name: "no releaes note",
+			args: args{
+				body: "release note description",
+			},
+			wantDescription:  "release note description",
+			wantReleaseNotes: []string{"NONE"},
+		},
+		{
+			name: "multiple release notes",
+			args: args{
+				body: "description\n```release-note\nfirst change\n```\n```release-note\n \n```\n```release-note\nsecond change\n```",
+			},
+			wantDescription:  "description\n\n\n",
+			wantReleaseNotes: []string{"first change", "second change"},
+		},
+		{
+			name: "multi-line release note",
+			args: args{
+				body: "description\n```release-note\nfirst line\nsecond line\n```",
+			},
+			wantDescription:  "description\n",
+			wantReleaseNotes: []string{"first line\nsecond line"},
+		},
+		{
+			name: "alternate fence",
+			args: args{
+				body:  "description\n```changelog\nchange\n```\n```release-note\nignored\n```",
+				fence: "changelog",
+			},
+			wantDescription:  "description\n\n```release-note\nignored\n```",
+			wantReleaseNotes: []string{"change"},
+		},
+		{
+			name: "fence with special characters",
+			args: args{
+				body:  "description\n```notes.v2+\nchange\n```\n```notesxv22\nignored\n```",
+				fence: "notes.v2+",
+			},
+			wantDescription:  "description\n\n```notesxv22\nignored\n```",
+			wantReleaseNotes: []string{"change"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fence := tt.args.fence
+			if fence == "" {
+				fence = "release-note"
+			}
+			gotDescription, gotReleaseNotes := splitReleaseNote(tt.args.body, fence)
+			if gotDescription != tt.wantDescription {
+				t.Errorf("splitReleaseNote() gotDescription = %v, want %v", gotDescription, tt.wantDescription)
+			}
+			if !reflect.DeepEqual(gotReleaseNotes, tt.wantReleaseNotes) {
+				t.Errorf("splitReleaseNote() gotReleaseNotes = %v, want %v", gotReleaseNotes, tt.wantReleaseNotes)
+			}
+		})
+	}
+}
+
+func Test_templates_splitReleaseNote(t *testing.T) {
+	strip := regexp.MustCompile(`^\s*- \[[ x]\]|(?i)^TODO`)
+	tests := []struct {
+		name             string
+		body             string
+		strip            *regexp.Regexp
+		wantDescription  string
+		wantReleaseNotes []string
+	}{
+		{
+			name:             "stray checklist line",
+			body:             "- [ ] tested\n```release-note\nFix crash on startup\n- [ ] update docs\n```",
+			strip:            strip,
+			wantDescription:  "- [ ] tested\n",
+			wantReleaseNotes: []string{"Fix crash on startup"},
+		},
+		{
+			name:             "note of stripped lines only",
+			body:             "description\n```release-note\nTODO\n```",
+			strip:            strip,
+			wantDescription:  "description\n",
+			wantReleaseNotes: []string{"NONE"},
+		},
+		{
+			name:             "no stripping by default",
+			body:             "description\n```release-note\nFix crash on startup\n- [ ] update docs\n```",
+			wantDescription:  "description\n",
+			wantReleaseNotes: []string{"Fix crash on startup\n- [ ] update docs"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpls := &templates{releaseNoteStrip: tt.strip}
+			gotDescription, gotReleaseNotes := tpls.splitReleaseNote(tt.body)
+			if gotDescription != tt.wantDescription {
+				t.Errorf("templates.splitReleaseNote() gotDescription = %q, want %q", gotDescription, tt.wantDescription)
+			}
+			if !reflect.DeepEqual(gotReleaseNotes, tt.wantReleaseNotes) {
+				t.Errorf("templates.splitReleaseNote() gotReleaseNotes = %q, want %q", gotReleaseNotes, tt.wantReleaseNotes)
+			}
+		})
+	}
+}
+
+func Test_parseCommand(t *testing.T) {
+	type args struct {
+		e env
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *command
+		wantErr error
+	}{
+		{
+			name: "trigger comment uses merge method",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "squash",
+					Commands:       commandMap{"/rebase": "rebase"},
+				},
+			},
+			want: &command{mergeMethod: "squash"},
+		},
+		{
+			name: "command overrides merge method",
+			args: args{
+				e: env{
+					Comment:        "/rebase\n",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					Commands:       commandMap{"/rebase": "rebase"},
+				},
+			},
+			want: &command{mergeMethod: "rebase", commanded: true},
+		},
+		{
+			name: "message override",
+			args: args{
+				e: env{
+					Comment:        "/merge message: Fix the parser bug\n",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+				},
+			},
+			want: &command{mergeMethod: "merge", message: "Fix the parser bug"},
+		},
+		{
+			name: "multi-line message override of command",
+			args: args{
+				e: env{
+					Comment:        "/squash\nmessage:\nFix the parser bug\n\nIt panicked on empty input.",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					Commands:       commandMap{"/squash": "squash"},
+				},
+			},
+			want: &command{mergeMethod: "squash", commanded: true, message: "Fix the parser bug\n\nIt panicked on empty input."},
+		},
+		{
+			name: "pull request numbers",
+			args: args{
+				e: env{
+					Comment:        "/merge #12 #15 #12 #18",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+				},
+			},
+			want: &command{mergeMethod: "merge", prNumbers: []int{12, 15, 18}},
+		},
+		{
+			name: "pull request of another repository",
+			args: args{
+				e: env{
+					Comment:        "/merge abema/other-repo#123",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+				},
+			},
+			want: &command{mergeMethod: "merge", target: &prTarget{owner: "abema", repo: "other-repo", number: 123}},
+		},
+		{
+			name: "pull request of another repository with pull request numbers",
+			args: args{
+				e: env{
+					Comment:        "/merge abema/other-repo#123 #12",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+				},
+			},
+			wantErr: errInvalidTarget,
+		},
+		{
+			name: "close comment cannot target another repository",
+			args: args{
+				e: env{
+					Comment:        "/close abema/other-repo#123",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					CloseComment:   "/close",
+				},
+			},
+			wantErr: errInvalidTarget,
+		},
+		{
+			name: "close comment cannot list pull request numbers",
+			args: args{
+				e: env{
+					Comment:        "/close #12",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					CloseComment:   "/close",
+				},
+			},
+			wantErr: errCloseListed,
+		},
+		{
+			name: "pull request numbers with message override",
+			args: args{
+				e: env{
+					Comment:        "/squash #12 #15 message: Bump dependencies",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					Commands:       commandMap{"/squash": "squash"},
+				},
+			},
+			want: &command{mergeMethod: "squash", commanded: true, message: "Bump dependencies", prNumbers: []int{12, 15}},
+		},
+		{
+			name: "message override requires a command",
+			args: args{
+				e: env{
+					Comment:        "message: Fix the parser bug",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+				},
+			},
+			wantErr: errNotCommand,
+		},
+		{
+			name: "close command",
+			args: args{
+				e: env{
+					Comment:        "/close",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					CloseComment:   "/close",
+				},
+			},
+			want: &command{mergeMethod: "merge", close: true},
+		},
+		{
+			name: "cancel command",
+			args: args{
+				e: env{
+					Comment:        "/merge cancel\n",
+					TriggerComment: "/merge",
+					MergeMethod:    "merge",
+					CancelComment:  "/merge cancel",
+				},
+			},
+			want: &command{mergeMethod: "merge", cancel: true},
+		},
+		{
+			name: "cancel command is not the trigger with strict comment match",
+			args: args{
+				e: env{
+					Comment:            "/merge cancel",
+					TriggerComment:     "/merge",
+					MergeMethod:        "merge",
+					CancelComment:      "/merge cancel",
+					StrictCommentMatch: true,
+				},
+			},
+			want: &command{mergeMethod: "merge", cancel: true},
+		},
+		{
+			name: "close command disabled",
+			args: args{
+				e: env{
+					Comment:        "/close",
+					TriggerComment: "/merge",
+				},
+			},
+			wantErr: errNotCommand,
+		},
+		{
+			name: "not a command",
+			args: args{
+				e: env{
+					Comment:        "LGTM",
+					TriggerComment: "/merge",
+					Commands:       commandMap{"/rebase": "rebase"},
+				},
+			},
+			wantErr: errNotCommand,
+		},
+		{
+			name: "trigger with trailing text requires strict comment match",
+			args: args{
+				e: env{
+					Comment:        "/merge after CI passes",
+					TriggerComment: "/merge",
+				},
+			},
+			wantErr: errNotCommand,
+		},
+		{
+			name: "strict comment match",
+			args: args{
+				e: env{
+					Comment:            "/rebase after CI passes",
+					TriggerComment:     "/merge",
+					MergeMethod:        "merge",
+					Commands:           commandMap{"/rebase": "rebase"},
+					StrictCommentMatch: true,
+				},
+			},
+			want: &command{mergeMethod: "rebase", commanded: true},
+		},
+		{
+			name: "strict comment match ignores trigger in the middle",
+			args: args{
+				e: env{
+					Comment:            "please /merge",
+					TriggerComment:     "/merge",
+					StrictCommentMatch: true,
+				},
+			},
+			wantErr: errNotCommand,
+		},
+		{
+			name: "strict comment match requires a whole word",
+			args: args{
+				e: env{
+					Comment:            "/mergeable?",
+					TriggerComment:     "/merge",
+					StrictCommentMatch: true,
+				},
+			},
+			wantErr: errNotCommand,
+		},
+		{
+			name: "bot mention",
+			args: args{
+				e: env{
+					Comment:        "@Merger /merge",
+					TriggerComment: "/merge",
+					MergeMethod:    "squash",
+					BotMention:     "@merger",
+				},
+			},
+			want: &command{mergeMethod: "squash"},
+		},
+		{
+			name: "bot mention required",
+			args: args{
+				e: env{
+					Comment:        "/merge",
+					TriggerComment: "/merge",
+					BotMention:     "@merger",
+				},
+			},
+			wantErr: errNotCommand,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCommand(tt.args.e)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		comment     string
+		wantComment string
+		wantMessage string
+	}{
+		{
+			name:        "without message",
+			comment:     "/merge",
+			wantComment: "/merge",
+		},
+		{
+			name:        "with message",
+			comment:     "/merge message: Fix the parser bug",
+			wantComment: "/merge",
+			wantMessage: "Fix the parser bug",
+		},
+		{
+			name:        "empty message",
+			comment:     "/merge message:",
+			wantComment: "/merge",
+		},
+		{
+			name:        "message: in a word is not a message",
+			comment:     "/merge commit-message: x",
+			wantComment: "/merge commit-message: x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotComment, gotMessage := splitMessage(tt.comment)
+			if gotComment != tt.wantComment || gotMessage != tt.wantMessage {
+				t.Errorf("splitMessage() = %q, %q, want %q, %q", gotComment, gotMessage, tt.wantComment, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func Test_splitPRNumbers(t *testing.T) {
+	tests := []struct {
+		name        string
+		comment     string
+		wantComment string
+		wantNumbers []int
+	}{
+		{
+			name:        "without numbers",
+			comment:     "/merge",
+			wantComment: "/merge",
+		},
+		{
+			name:        "with numbers",
+			comment:     "/merge #12\t#15",
+			wantComment: "/merge",
+			wantNumbers: []int{12, 15},
+		},
+		{
+			name:        "numbers in the middle are not listed",
+			comment:     "/merge #12 after #15 passes",
+			wantComment: "/merge #12 after #15 passes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotComment, gotNumbers := splitPRNumbers(tt.comment)
+			if gotComment != tt.wantComment || !reflect.DeepEqual(gotNumbers, tt.wantNumbers) {
+				t.Errorf("splitPRNumbers() = %q, %v, want %q, %v", gotComment, gotNumbers, tt.wantComment, tt.wantNumbers)
+			}
+		})
+	}
+}
+
+func Test_quote(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "single line", s: "pull request body", want: "> pull request body"},
+		{name: "paragraphs", s: "first\n\nsecond\n", want: "> first\n>\n> second\n"},
+		{name: "crlf", s: "first\r\n\r\nsecond", want: "> first\n>\n> second"},
+		{name: "empty", s: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quote(tt.s); got != tt.want {
+				t.Errorf("quote() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ignoreLabels(t *testing.T) {
+	labels := []string{"size/L", "LGTM", "kind/feature", "bug"}
+	tests := []struct {
+		name   string
+		ignore []string
+		want   []string
+	}{
+		{name: "glob", ignore: []string{"size/*"}, want: []string{"LGTM", "kind/feature", "bug"}},
+		{name: "case-insensitive", ignore: []string{"lgtm", "Kind/*"}, want: []string{"size/L", "bug"}},
+		{name: "star matches slashes", ignore: []string{"size*"}, want: []string{"LGTM", "kind/feature", "bug"}},
+		{name: "star matches every label", ignore: []string{"*"}, want: []string{}},
+		{name: "question matches a slash", ignore: []string{"kind?feature"}, want: []string{"size/L", "LGTM", "bug"}},
+		{name: "special characters are literal", ignore: []string{"size.L"}, want: labels},
+		{name: "not specified", want: labels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpls, err := loadTemplates(env{LabelIgnore: tt.ignore})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ignoreLabels(labels, tpls.labelIgnore); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ignoreLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_releaseNoteCategory(t *testing.T) {
+	categories := map[string]string{"kind/feature": "feature", "kind/bug": "bugfix"}
+	tests := []struct {
+		name   string
+		labels []string
+		want   string
+	}{
+		{name: "mapped label", labels: []string{"lgtm", "Kind/Bug"}, want: "bugfix"},
+		{name: "first mapped label", labels: []string{"kind/feature", "kind/bug"}, want: "feature"},
+		{name: "no mapped label", labels: []string{"lgtm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := releaseNoteCategory(tt.labels, categories); got != tt.want {
+				t.Errorf("releaseNoteCategory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_categoryMap_Decode(t *testing.T) {
+	var got categoryMap
+	if err := got.Decode("kind/feature=feature, kind/bug=bugfix"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (categoryMap{"kind/feature": "feature", "kind/bug": "bugfix"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("categoryMap.Decode() = %v, want %v", got, want)
+	}
+	if err := got.Decode("kind/feature"); err == nil {
+		t.Error("categoryMap.Decode() should fail with invalid format")
+	}
+}
+
+func Test_commandMap_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    commandMap
+		wantErr bool
+	}{
+		{
+			name:  "commands",
+			value: "/squash=squash, /rebase=rebase",
+			want:  commandMap{"/squash": "squash", "/rebase": "rebase"},
+		},
+		{
+			name:  "empty",
+			value: "",
+			want:  commandMap{},
+		},
+		{
+			name:    "invalid format",
+			value:   "/squash",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got commandMap
+			if err := got.Decode(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("commandMap.Decode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commandMap.Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_labelMergeMethod(t *testing.T) {
+	methods := map[string]string{"squash-me": "squash", "rebase-me": "rebase"}
+	tests := []struct {
+		name    string
+		labels  []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "mapped label",
+			labels: []string{"enhancement", "Squash-Me"},
+			want:   "squash",
+		},
+		{
+			name:   "no mapped label",
+			labels: []string{"enhancement"},
+		},
+		{
+			name:    "multiple mapped labels",
+			labels:  []string{"squash-me", "rebase-me"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{}
+			for _, l := range tt.labels {
+				pr.Labels = append(pr.Labels, &github.Label{Name: github.String(l)})
+			}
+			got, err := labelMergeMethod(pr, methods)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("labelMergeMethod() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("labelMergeMethod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_blockingLabel(t *testing.T) {
+	type args struct {
+		pr          *github.PullRequest
+		blockLabels []string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantLabel string
+		wantOK    bool
+	}{
+		{
+			name: "blocked by label",
+			args: args{
+				pr: &github.PullRequest{
+					Labels: []*github.Label{
+						{Name: github.String("enhancement")},
+						{Name: github.String("Do-Not-Merge")},
+					},
+				},
+				blockLabels: []string{"do-not-merge", "WIP"},
+			},
+			wantLabel: "Do-Not-Merge",
+			wantOK:    true,
+		},
+		{
+			name: "not blocked",
+			args: args{
+				pr: &github.PullRequest{
+					Labels: []*github.Label{
+						{Name: github.String("enhancement")},
+					},
+				},
+				blockLabels: []string{"do-not-merge"},
+			},
+		},
+		{
+			name: "no block labels",
+			args: args{
+				pr: &github.PullRequest{
+					Labels: []*github.Label{
+						{Name: github.String("do-not-merge")},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotLabel, gotOK := blockingLabel(tt.args.pr, tt.args.blockLabels)
+			if gotLabel != tt.wantLabel {
+				t.Errorf("blockingLabel() gotLabel = %v, want %v", gotLabel, tt.wantLabel)
+			}
+			if gotOK != tt.wantOK {
+				t.Errorf("blockingLabel() gotOK = %v, want %v", gotOK, tt.wantOK)
+			}
+		})
+	}
+}
+
+func Test_missingLabels(t *testing.T) {
+	type args struct {
+		pr            *github.PullRequest
+		requireLabels []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "all required labels present",
+			args: args{
+				pr: &github.PullRequest{
+					Labels: []*github.Label{
+						{Name: github.String("LGTM")},
+						{Name: github.String("approved")},
+					},
+				},
+				requireLabels: []string{"lgtm", "approved"},
+			},
+		},
+		{
+			name: "missing labels",
+			args: args{
+				pr: &github.PullRequest{
+					Labels: []*github.Label{
+						{Name: github.String("lgtm")},
+					},
+				},
+				requireLabels: []string{"lgtm", "approved", "qa-passed"},
+			},
+			want: []string{"approved", "qa-passed"},
+		},
+		{
+			name: "no required labels",
+			args: args{
+				pr: &github.PullRequest{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingLabels(tt.args.pr, tt.args.requireLabels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hasLabel(t *testing.T) {
+	pr := &github.PullRequest{
+		Labels: []*github.Label{
+			{Name: github.String("Override-Protected")},
+		},
+	}
+	tests := []struct {
+		name  string
+		label string
+		want  bool
+	}{
+		{name: "has label ignoring case", label: "override-protected", want: true},
+		{name: "does not have label", label: "lgtm"},
+		{name: "empty label", label: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasLabel(pr, tt.label); got != tt.want {
+				t.Errorf("hasLabel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadTemplates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "commit.tpl")
+	if err := os.WriteFile(file, []byte("{{ .Message }} from file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pr := &github.PullRequest{
+		Title:  github.String("pull request title"),
+		Number: github.Int(1),
+		Body:   github.String("pull request body"),
+		User:   &github.User{Login: github.String("0daryo")},
+	}
+	tests := []struct {
+		name    string
+		e       env
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "built-in template",
+			e:    env{ReleaseNote: true},
+			want: "\npull request body\n\n```release-note\n* NONE\n```",
+		},
+		{
+			name: "template from env",
+			e: env{
+				BodyTemplate:     "{{ .Message }} from env",
+				BodyTemplateFile: file,
+			},
+			want: "pull request body from env",
+		},
+		{
+			name: "template from file",
+			e: env{
+				BodyTemplateFile: file,
+			},
+			want: "pull request body from file",
+		},
+		{
+			name: "template with pull request fields",
+			e: env{
+				BodyTemplate: "{{ .Title }} (#{{ .Number }})\nMerged by @{{ .Author }}",
+			},
+			want: "pull request title (#1)\nMerged by @0daryo",
+		},
+		{
+			name: "release note disabled",
+			e:    env{},
+			want: "\npull request body\n",
+		},
+		{
+			name: "invalid template",
+			e: env{
+				BodyTemplate: "{{ .Message ",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid subject template",
+			e: env{
+				SubjectTemplate: "{{ .Title ",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid boilerplate pattern",
+			e: env{
+				BoilerplatePatterns: []string{"^## ("},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid release note strip pattern",
+			e: env{
+				ReleaseNoteStrip: "^- [",
+			},
+			wantErr: true,
+		},
+		{
+			name: "subject template with label",
+			e: env{
+				ReleaseNote:     true,
+				SubjectTemplate: "{{ index .Labels 0 }}: {{ .Title }}",
+			},
+			want: "\npull request body\n\n```release-note\n* NONE\n```",
+		},
+		{
+			name: "subject template with unknown field",
+			e: env{
+				SubjectTemplate: "{{ .Subject }}",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing template file",
+			e: env{
+				BodyTemplateFile: filepath.Join(t.TempDir(), "missing.tpl"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "message template with unknown field",
+			e: env{
+				MessageTemplate: "{{ .Title }}",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadTemplates(tt.e)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadTemplates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			body, err := generateCommitBody(pr, nil, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != tt.want {
+				t.Errorf("loadTemplates() body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeSummary(t *testing.T) {
+	type args struct {
+		prNumber int
+		r        *mergeResult
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "already merged",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:   "merge",
+					alreadyMerged: true,
+					mergedBy:      "octocat",
+				},
+			},
+			want: "PR #1 is already merged (by octocat).\n",
+		},
+		{
+			name: "merged with success marker",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod: "merge",
+					sha:         "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					headSHA:     "head",
+					commentID:   100,
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: not deleted\n" +
+				"<!-- github-actions-merger:success comment=100 -->\n",
+		},
+		{
+			name: "merged with commit message marker",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:   "merge",
+					sha:           "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					commitMessage: "body",
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: not deleted\n" +
+				"<!-- github-actions-merger:commit-message Ym9keQ== -->\n",
+		},
+		{
+			name: "merged with fallback merge method",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:   "merge",
+					fallbackFrom:  "squash",
+					sha:           "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					branchDeleted: true,
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge` (`squash` is not allowed)\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: deleted\n",
+		},
+		{
+			name: "merged with closed issues",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:  "merge",
+					sha:          "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					closedIssues: []int{123, 456},
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: not deleted\n" +
+				"- Closed issues: #123, #456\n",
+		},
+		{
+			name: "merged with release notes",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:  "merge",
+					sha:          "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					releaseNotes: []string{"Breaking change!\nsee docs", "Fix crash"},
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: not deleted\n" +
+				"- Release note: Breaking change! see docs\n" +
+				"- Release note: Fix crash\n",
+		},
+		{
+			name: "merged without release note",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:  "merge",
+					sha:          "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					releaseNotes: []string{"NONE"},
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: not deleted\n" +
+				"- Release note: NONE\n",
+		},
+		{
+			name: "queued pending approval",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:      "squash",
+					queued:           true,
+					pendingApprovals: []string{"need 2 approvals, have 1"},
+				},
+			},
+			want: "Queued PR #1 to merge automatically once it is approved.\n\n" +
+				"- Merge method: `squash`\n" +
+				"- Pending: need 2 approvals, have 1\n",
+		},
+		{
+			name: "queued does not show closed issues",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:  "merge",
+					queued:       true,
+					closedIssues: []int{123},
+				},
+			},
+			want: "Queued PR #1 to merge automatically once requirements are met.\n\n" +
+				"- Merge method: `merge`\n",
+		},
+		{
+			name: "merged",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod:   "squash",
+					sha:           "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					branchDeleted: true,
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `squash`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: deleted\n",
+		},
+		{
+			name: "merged with approval",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod: "merge",
+					sha:         "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+					approvedBy:  "0daryo",
+				},
+			},
+			want: "Merged PR #1 successfully!\n\n" +
+				"- Merge method: `merge`\n" +
+				"- Merge commit: 6dcb09b5b57875f334f61aebed695e2e4193db5e\n" +
+				"- Head branch: not deleted\n" +
+				"- Approval was added on behalf of @0daryo\n",
+		},
+		{
+			name: "merge queue",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod: "merge",
+					queued:      true,
+					mergeQueue:  true,
+				},
+			},
+			want: "Added PR #1 to the merge queue.\n",
+		},
+		{
+			name: "queued",
+			args: args{
+				prNumber: 1,
+				r: &mergeResult{
+					mergeMethod: "merge",
+					queued:      true,
+				},
+			},
+			want: "Queued PR #1 to merge automatically once requirements are met.\n\n" +
+				"- Merge method: `merge`\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeSummary(tt.args.prNumber, tt.args.r); got != tt.want {
+				t.Errorf("mergeSummary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hasStatus(t *testing.T) {
+	type args struct {
+		err   error
+		codes []int
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "matched status",
+			args: args{
+				err:   fmt.Errorf("failed: %w", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}),
+				codes: []int{http.StatusForbidden, http.StatusNotFound},
+			},
+			want: true,
+		},
+		{
+			name: "unmatched status",
+			args: args{
+				err:   &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusInternalServerError}},
+				codes: []int{http.StatusNotFound},
+			},
+		},
+		{
+			name: "not error response",
+			args: args{
+				err:   errors.New("not found"),
+				codes: []int{http.StatusNotFound},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasStatus(tt.args.err, tt.args.codes...); got != tt.want {
+				t.Errorf("hasStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_commitMessage(t *testing.T) {
+	pr := &github.PullRequest{
+		Body: github.String("pull request body\n```release-note\nThis is great release!!!\n```"),
+		Labels: []*github.Label{
+			{Name: github.String("label1")},
+		},
+		User: &github.User{Login: github.String("alice")},
+	}
+	commits := []commit{
+		{SHA: "a1", Message: "first", Author: "Alice <alice@example.com>", Login: "alice"},
+		{SHA: "b2", Message: "second", Author: "Bob <bob@example.com>", Login: "bob"},
+		{SHA: "c3", Message: "third", Author: "Carol <carol@example.com>", Login: "carol"},
+	}
+	type args struct {
+		e           env
+		mergeMethod string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "squash with co-authors",
+			args: args{
+				e:           env{SquashUsePRBody: true, IncludeCoauthors: true},
+				mergeMethod: "squash",
+			},
+			want: "pull request body\n\nCo-authored-by: Bob <bob@example.com>\nCo-authored-by: Carol <carol@example.com>",
+		},
+		{
+			name: "co-authors with truncated commits",
+			args: args{
+				e:           env{IncludeCommits: true, MaxCommits: 1, IncludeCoauthors: true},
+				mergeMethod: "squash",
+			},
+			want: "\npull request body\n\n\nLabels:\n  * label1\n\nCommits:\n  * a1 first\n```release-note\n* This is great release!!!\n```\n\nCo-authored-by: Bob <bob@example.com>\nCo-authored-by: Carol <carol@example.com>",
+		},
+		{
+			name: "no co-authors of merge commits",
+			args: args{
+				e:           env{SquashUsePRBody: true, IncludeCoauthors: true},
+				mergeMethod: "merge",
+			},
+			want: "\npull request body\n\n\nLabels:\n  * label1\n```release-note\n* This is great release!!!\n```",
+		},
+		{
+			name: "squash with pull request body",
+			args: args{
+				e:           env{SquashUsePRBody: true},
+				mergeMethod: "squash",
+			},
+			want: "pull request body",
+		},
+		{
+			name: "merge uses template",
+			args: args{
+				e:           env{SquashUsePRBody: true},
+				mergeMethod: "merge",
+			},
+			want: "\npull request body\n\n\nLabels:\n  * label1\n```release-note\n* This is great release!!!\n```",
+		},
+		{
+			name: "squash uses template by default",
+			args: args{
+				e:           env{},
+				mergeMethod: "squash",
+			},
+			want: "\npull request body\n\n\nLabels:\n  * label1\n```release-note\n* This is great release!!!\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commitMessage(pr, commits, tt.args.e, tt.args.mergeMethod, &templates{body: bodyTpl, subject: subjectTpl})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("commitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// errorResponse returns an error response from github for merge api.
+func errorResponse(status int, message string) *github.ErrorResponse {
+	u, _ := url.Parse("https://api.github.com/repos/abema/github-actions-merger/pulls/1/merge")
+	return &github.ErrorResponse{
+		Response: &http.Response{
+			StatusCode: status,
+			Request:    &http.Request{Method: http.MethodPut, URL: u},
+		},
+		Message: message,
+	}
+}
+
+func Test_closingIssues(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []int
+	}{
+		{
+			name: "keyword variants",
+			body: "Closes #1\nfixed #2, Resolve #3 and close #4\nFIXES: #5\nresolves #6, fix #7, closed #8, resolved #9",
+			want: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name: "duplicates",
+			body: "fixes #2\ncloses #1\ncloses #2",
+			want: []int{2, 1},
+		},
+		{
+			name: "not closing keywords",
+			body: "related to #1\nprefix #2\nfixing #3\ncloses#4\nhotfix #5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := closingIssues(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("closingIssues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_openLongEnough(t *testing.T) {
+	now := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		createdAt  time.Time
+		minMinutes int
+		want       time.Duration
+		wantOk     bool
+	}{
+		{
+			name:       "open long enough",
+			createdAt:  now.Add(-30 * time.Minute),
+			minMinutes: 30,
+			want:       30 * time.Minute,
+			wantOk:     true,
+		},
+		{
+			name:       "too new",
+			createdAt:  now.Add(-5 * time.Minute),
+			minMinutes: 30,
+			want:       5 * time.Minute,
+		},
+		{
+			name:      "disabled",
+			createdAt: now,
+			wantOk:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{CreatedAt: &tt.createdAt}
+			got, ok := openLongEnough(pr, tt.minMinutes, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("openLongEnough() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_sizeExceeded(t *testing.T) {
+	pr := &github.PullRequest{
+		ChangedFiles: github.Int(12),
+		Additions:    github.Int(300),
+		Deletions:    github.Int(200),
+	}
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxLines int
+		want     []string
+	}{
+		{
+			name:     "within limits",
+			maxFiles: 12,
+			maxLines: 500,
+		},
+		{
+			name:     "too many files",
+			maxFiles: 10,
+			want:     []string{"12 files changed (allowed 10)"},
+		},
+		{
+			name:     "too many lines and files",
+			maxFiles: 10,
+			maxLines: 400,
+			want:     []string{"12 files changed (allowed 10)", "500 lines changed (allowed 400)"},
+		},
+		{
+			name: "no limit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sizeExceeded(pr, tt.maxFiles, tt.maxLines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sizeExceeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isFork(t *testing.T) {
+	repo := func(owner, name string) *github.Repository {
+		return &github.Repository{Name: github.String(name), Owner: &github.User{Login: github.String(owner)}}
+	}
+	tests := []struct {
+		name string
+		head *github.Repository
+		want bool
+	}{
+		{
+			name: "same repository",
+			head: repo("abema", "github-actions-merger"),
+		},
+		{
+			name: "same repository in different case",
+			head: repo("Abema", "GitHub-Actions-Merger"),
+		},
+		{
+			name: "fork",
+			head: repo("someone", "github-actions-merger"),
+			want: true,
+		},
+		{
+			name: "renamed fork of the same owner",
+			head: repo("abema", "merger"),
+			want: true,
+		},
+		{
+			name: "deleted fork",
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{
+				Base: &github.PullRequestBranch{Repo: repo("abema", "github-actions-merger")},
+				Head: &github.PullRequestBranch{Repo: tt.head},
+			}
+			if got := isFork(pr); got != tt.want {
+				t.Errorf("isFork() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_getPullRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantDraft bool
+	}{
+		{
+			name:      "draft",
+			body:      `{"number":1,"head":{"sha":"head"},"draft":true,"mergeable_state":"unknown"}`,
+			wantDraft: true,
+		},
+		{
+			name: "ready for review",
+			body: `{"number":1,"head":{"sha":"head"},"draft":false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/repos/abema/github-actions-merger/pulls/1" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			pr, draft, err := gh.getPullRequest(context.Background(), "abema", "github-actions-merger", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pr.GetNumber() != 1 || pr.GetHead().GetSHA() != "head" {
+				t.Errorf("ghClient.getPullRequest() = %+v", pr)
+			}
+			if draft != tt.wantDraft {
+				t.Errorf("ghClient.getPullRequest() draft = %v, want %v", draft, tt.wantDraft)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_draft(t *testing.T) {
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the branch must not be updated before refusing.
+		if r.Method != http.MethodGet || r.URL.Path != "/repos/abema/github-actions-merger/pulls/1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"number":1,"title":"title","draft":true,"base":{"ref":"main"},"head":{"sha":"head","ref":"feature"}}`))
+	}))
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, UpdateBranch: true}
+	_, err := gh.merge(context.Background(), e, &command{mergeMethod: "merge"}, &templates{body: bodyTpl, subject: subjectTpl})
+	if got := failureReason(err); got != reasonDraft {
+		t.Errorf("ghClient.merge() error = %v, want reason %s", err, reasonDraft)
+	}
+}
+
+func Test_useAutoMerge(t *testing.T) {
+	labeled := &github.PullRequest{Labels: []*github.Label{{Name: github.String("auto-merge")}}}
+	tests := []struct {
+		name string
+		e    env
+		pr   *github.PullRequest
+		want bool
+	}{
+		{name: "enable auto merge", e: env{EnableAutoMerge: true}, pr: &github.PullRequest{}, want: true},
+		{name: "disabled", e: env{}, pr: labeled},
+		{name: "labeled", e: env{AutoMergeLabel: "auto-merge"}, pr: labeled, want: true},
+		{name: "not labeled", e: env{AutoMergeLabel: "auto-merge", EnableAutoMerge: true}, pr: &github.PullRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := useAutoMerge(tt.e, tt.pr); got != tt.want {
+				t.Errorf("useAutoMerge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_autoMergeCommand(t *testing.T) {
+	e := env{
+		Owner:          "abema",
+		Repo:           "github-actions-merger",
+		CommitterName:  "merger-bot",
+		CommitterEmail: "merger-bot@example.com",
+		SignCommits:    true,
+		SigningKey:     "3AA5C34371567BD2",
+	}
+	c := autoMergeCommand(e, 1, "squash", "pull request title (#1)", "/tmp/merger-body.txt")
+	wantArgs := []string{"gh", "pr", "merge", "1", "--squash", "--auto", "--subject", "pull request title (#1)", "--body-file", "/tmp/merger-body.txt", "--repo", "abema/github-actions-merger"}
+	if !reflect.DeepEqual(c.Args, wantArgs) {
+		t.Errorf("autoMergeCommand() args = %v, want %v", c.Args, wantArgs)
+	}
+	for _, want := range []string{
+		"GIT_AUTHOR_NAME=merger-bot",
+		"GIT_COMMITTER_NAME=merger-bot",
+		"GIT_AUTHOR_EMAIL=merger-bot@example.com",
+		"GIT_COMMITTER_EMAIL=merger-bot@example.com",
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=commit.gpgsign",
+		"GIT_CONFIG_VALUE_0=true",
+		"GIT_CONFIG_KEY_1=user.signingkey",
+		"GIT_CONFIG_VALUE_1=3AA5C34371567BD2",
+	} {
+		found := false
+		for _, got := range c.Env {
+			if got == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("autoMergeCommand() env does not include %s", want)
+		}
+	}
+}
+
+func Test_runAutoMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		stderr  string
+		exit    string
+		wantErr string
+	}{
+		{
+			name: "succeeded",
+			exit: "0",
+		},
+		{
+			name:    "failed with stderr",
+			stderr:  "GraphQL: Pull request Protected branch rules not configured for this branch (enablePullRequestAutoMerge)",
+			exit:    "1",
+			wantErr: "gh pr merge failed: exit status 1: GraphQL: Pull request Protected branch rules not configured for this branch (enablePullRequestAutoMerge)",
+		},
+		{
+			name:    "long stderr is truncated",
+			stderr:  strings.Repeat("x", maxCommandOutput+1),
+			exit:    "1",
+			wantErr: "gh pr merge failed: exit status 1: " + strings.Repeat("x", maxCommandOutput) + "...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubCommand(t, tt.stderr, tt.exit)
+			err := runAutoMerge(env{Owner: "abema", Repo: "github-actions-merger"}, 1, "merge", "subject", "body")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("runAutoMerge() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("runAutoMerge() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkGHInstalled(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "installed"},
+		{name: "not installed", err: exec.ErrNotFound, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := lookPath
+			t.Cleanup(func() { lookPath = orig })
+			lookPath = func(file string) (string, error) {
+				if tt.err != nil {
+					return "", tt.err
+				}
+				return "/bin/" + file, nil
+			}
+			if err := checkGHInstalled(); (err != nil) != tt.wantErr {
+				t.Errorf("checkGHInstalled() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// stubCommand replaces execCommand with the test binary which writes stderr and exits with exit.
+func stubCommand(t *testing.T, stderr, exit string) {
+	t.Helper()
+	orig := execCommand
+	t.Cleanup(func() { execCommand = orig })
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		return exec.Command(os.Args[0], append([]string{"-test.run=TestHelperProcess", "--", name}, args...)...)
+	}
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_STDERR", stderr)
+	t.Setenv("HELPER_EXIT", exit)
+}
+
+// TestHelperProcess is not a real test, but a fake command run by stubCommand.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	fmt.Fprint(os.Stderr, os.Getenv("HELPER_STDERR"))
+	code, _ := strconv.Atoi(os.Getenv("HELPER_EXIT"))
+	os.Exit(code)
+}
+
+func Test_writeTempFile(t *testing.T) {
+	body := strings.Repeat("large pull request body\n", 100000)
+	path, err := writeTempFile("merger-body-*.txt", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("writeTempFile() wrote %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func Test_committerEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		e    env
+		want []string
+	}{
+		{
+			name: "name and email",
+			e:    env{CommitterName: "merger-bot", CommitterEmail: "merger-bot@example.com"},
+			want: []string{"GIT_AUTHOR_NAME=merger-bot", "GIT_COMMITTER_NAME=merger-bot", "GIT_AUTHOR_EMAIL=merger-bot@example.com", "GIT_COMMITTER_EMAIL=merger-bot@example.com"},
+		},
+		{
+			name: "name only",
+			e:    env{CommitterName: "merger-bot"},
+			want: []string{"GIT_AUTHOR_NAME=merger-bot", "GIT_COMMITTER_NAME=merger-bot"},
+		},
+		{
+			name: "not specified",
+			e:    env{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := committerEnv(tt.e); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("committerEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_signingEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		e    env
+		want []string
+	}{
+		{
+			name: "key and format",
+			e:    env{SignCommits: true, SigningKey: "~/.ssh/id_ed25519.pub", SigningFormat: "ssh"},
+			want: []string{
+				"GIT_CONFIG_COUNT=3",
+				"GIT_CONFIG_KEY_0=commit.gpgsign", "GIT_CONFIG_VALUE_0=true",
+				"GIT_CONFIG_KEY_1=user.signingkey", "GIT_CONFIG_VALUE_1=~/.ssh/id_ed25519.pub",
+				"GIT_CONFIG_KEY_2=gpg.format", "GIT_CONFIG_VALUE_2=ssh",
+			},
+		},
+		{
+			name: "default key",
+			e:    env{SignCommits: true},
+			want: []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=commit.gpgsign", "GIT_CONFIG_VALUE_0=true"},
+		},
+		{
+			name: "signing disabled",
+			e:    env{SigningKey: "3AA5C34371567BD2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signingEnv(tt.e); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("signingEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decorate(t *testing.T) {
+	tests := []struct {
+		name      string
+		e         env
+		succeeded bool
+		want      string
+	}{
+		{
+			name:      "success",
+			e:         env{Emoji: true, ErrorPrefix: "❌"},
+			succeeded: true,
+			want:      "✅ Merged PR #1 successfully!",
+		},
+		{
+			name: "error",
+			e:    env{Emoji: true, ErrorPrefix: "❌"},
+			want: "❌ Merged PR #1 successfully!",
+		},
+		{
+			name: "custom error prefix",
+			e:    env{Emoji: true, ErrorPrefix: ":warning:"},
+			want: ":warning: Merged PR #1 successfully!",
+		},
+		{
+			name:      "emoji disabled",
+			e:         env{ErrorPrefix: "❌"},
+			succeeded: true,
+			want:      "Merged PR #1 successfully!",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decorate(tt.e, "Merged PR #1 successfully!", tt.succeeded); got != tt.want {
+				t.Errorf("decorate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeabilityDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		want   []time.Duration
+	}{
+		{
+			name:   "without jitter",
+			jitter: 0,
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second},
+		},
+		{
+			name:   "with jitter",
+			jitter: 0.5,
+			want:   []time.Duration{1250 * time.Millisecond, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for attempt, want := range tt.want {
+				if got := mergeabilityDelay(attempt, tt.jitter); got != want {
+					t.Errorf("mergeabilityDelay(%d, %v) = %v, want %v", attempt, tt.jitter, got, want)
+				}
+			}
+		})
+	}
+	// long waits keep the cap.
+	if got := mergeabilityDelay(100, 0); got != mergeabilityMaxInterval {
+		t.Errorf("mergeabilityDelay(100, 0) = %v, want %v", got, mergeabilityMaxInterval)
+	}
+}
+
+func Test_abort(t *testing.T) {
+	origExit, origHooks := osExit, exitHooks
+	t.Cleanup(func() { osExit, exitHooks = origExit, origHooks })
+	code, hooked := -1, false
+	osExit = func(c int) { code = c }
+	exitHooks = []func(){func() { hooked = true }}
+
+	abort(env{}, "failed")
+	if code != 1 || !hooked {
+		t.Errorf("abort() exited with %d, hooks run %v, want 1, true", code, hooked)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "failed" {
+				t.Errorf("abort() with DEBUG_PANIC recovered %v, want panic", r)
+			}
+		}()
+		abort(env{DebugPanic: true}, "failed")
+	}()
+}
+
+func Test_jobTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds string
+		want    time.Duration
+	}{
+		{
+			name:    "seconds",
+			seconds: "1200",
+			want:    20 * time.Minute,
+		},
+		{
+			name:    "not integer",
+			seconds: "10m",
+			want:    defaultJobTimeout,
+		},
+		{
+			name:    "not positive",
+			seconds: "0",
+			want:    defaultJobTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jobTimeout(tt.seconds); got != tt.want {
+				t.Errorf("jobTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestGHClient returns ghClient which requests to the handler instead of github.
+func Test_ghClient_mergePR(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		conflict   string
+		refetched  string
+		wantMerges int
+		wantSHA    string
+		wantErr    bool
+	}{
+		{
+			name:       "merged",
+			statuses:   []int{http.StatusOK},
+			wantMerges: 1,
+			wantSHA:    "merged",
+		},
+		{
+			name:       "retry once when base branch was modified",
+			statuses:   []int{http.StatusConflict, http.StatusOK},
+			wantMerges: 2,
+			wantSHA:    "merged",
+		},
+		{
+			name:       "base branch was modified twice",
+			statuses:   []int{http.StatusConflict, http.StatusConflict},
+			wantMerges: 2,
+			wantErr:    true,
+		},
+		{
+			name:       "closed pull request is not retried",
+			statuses:   []int{http.StatusConflict},
+			refetched:  `{"number":1,"state":"closed"}`,
+			wantMerges: 1,
+			wantErr:    true,
+		},
+		{
+			name:       "merged pull request is not retried",
+			statuses:   []int{http.StatusConflict},
+			refetched:  `{"number":1,"state":"closed","merged":true}`,
+			wantMerges: 1,
+			wantErr:    true,
+		},
+		{
+			name:       "head branch modified is not retried",
+			statuses:   []int{http.StatusConflict},
+			conflict:   "Head branch was modified. Review and try the merge again.",
+			wantMerges: 1,
+			wantErr:    true,
+		},
+		{
+			name:       "not mergeable is not retried",
+			statuses:   []int{http.StatusMethodNotAllowed},
+			wantMerges: 1,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merges := 0
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					refetched := tt.refetched
+					if refetched == "" {
+						refetched = `{"number":1,"state":"open"}`
+					}
+					w.Write([]byte(refetched))
+					return
+				}
+				var req struct {
+					SHA string `json:"sha"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SHA != "head" {
+					t.Errorf("merge request sha = %q, want head", req.SHA)
+				}
+				status := tt.statuses[merges]
+				merges++
+				w.WriteHeader(status)
+				switch status {
+				case http.StatusOK:
+					w.Write([]byte(`{"sha":"merged","merged":true}`))
+				case http.StatusConflict:
+					conflict := tt.conflict
+					if conflict == "" {
+						conflict = "Base branch was modified. Review and try the merge again."
+					}
+					fmt.Fprintf(w, `{"message":%q}`, conflict)
+				default:
+					w.Write([]byte(`{"message":"Pull Request is not mergeable"}`))
+				}
+			}))
+			got, err := gh.mergePR(context.Background(), "abema", "github-actions-merger", 1, "body", &github.PullRequestOptions{MergeMethod: "merge", SHA: "head"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.mergePR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if merges != tt.wantMerges {
+				t.Errorf("ghClient.mergePR() merged %d times, want %d", merges, tt.wantMerges)
+			}
+			if got.GetSHA() != tt.wantSHA {
+				t.Errorf("ghClient.mergePR() sha = %v, want %v", got.GetSHA(), tt.wantSHA)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_alreadyMerged(t *testing.T) {
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/repos/abema/github-actions-merger/pulls/1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"number":1,"title":"title","merged":true,"merge_commit_sha":"abc123","merged_by":{"login":"octocat"}}`))
+	}))
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, RequireChecks: true, MinApprovals: 1}
+	got, err := gh.merge(context.Background(), e, &command{mergeMethod: "merge"}, &templates{body: bodyTpl, subject: subjectTpl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &mergeResult{title: "title", mergeMethod: "merge", sha: "abc123", alreadyMerged: true, mergedBy: "octocat"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ghClient.merge() = %+v, want %+v", got, want)
+	}
+}
+
+func newTestGHClient(t *testing.T, h http.Handler) *ghClient {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	gh := newGHClientWithHTTP(srv.Client())
+	gh.client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return gh
+}
+
+func Test_ghClient_sendMsg(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		max     int
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "sent",
+			msg:    "Merged PR #1 successfully!",
+			status: http.StatusCreated,
+			want:   "Merged PR #1 successfully!",
+		},
+		{
+			name:   "oversized message is truncated",
+			msg:    "❌ " + strings.Repeat("error output\n", 10000),
+			max:    65000,
+			status: http.StatusCreated,
+			want:   truncateComment("❌ "+strings.Repeat("error output\n", 10000), 65000),
+		},
+		{
+			name:    "forbidden",
+			msg:     "Merged PR #1 successfully!",
+			status:  http.StatusForbidden,
+			want:    "Merged PR #1 successfully!",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/repos/abema/github-actions-merger/issues/1/comments" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{}`))
+					return
+				}
+				var c github.IssueComment
+				if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+					t.Error(err)
+				}
+				got = c.GetBody()
+				if tt.status != http.StatusCreated {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"id":1}`))
+			}))
+			gh.maxCommentBytes = tt.max
+			err := gh.sendMsg(context.Background(), "abema", "github-actions-merger", 1, tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.sendMsg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.sendMsg() sent %q, want %q", got, tt.want)
+			}
+			if tt.max > 0 && (len(got) > tt.max || !strings.HasSuffix(got, truncatedSuffix)) {
+				t.Errorf("ghClient.sendMsg() sent %d bytes, want at most %d with the suffix", len(got), tt.max)
+			}
+		})
+	}
+}
+
+func Test_ghClient_sendResult(t *testing.T) {
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}
+	quiet := e
+	quiet.QuietSuccess = true
+	tests := []struct {
+		name      string
+		e         env
+		msg       string
+		succeeded bool
+		want      []string
+	}{
+		{
+			name:      "success",
+			e:         e,
+			msg:       "Merged PR #1 successfully!\n" + successMarker(100),
+			succeeded: true,
+			want:      []string{renderMessage(e, "Merged PR #1 successfully!\n"+successMarker(100), true, "")},
+		},
+		{
+			name:      "quiet success posts nothing",
+			e:         quiet,
+			msg:       "Merged PR #1 successfully!\n" + successMarker(100),
+			succeeded: true,
+		},
+		{
+			name: "quiet failure is still posted",
+			e:    quiet,
+			msg:  "- #2: failed to merge",
+			want: []string{renderMessage(quiet, "- #2: failed to merge", false, "")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/repos/abema/github-actions-merger/issues/1/comments" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{}`))
+					return
+				}
+				var c github.IssueComment
+				if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+					t.Error(err)
+				}
+				got = append(got, c.GetBody())
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id":1}`))
+			}))
+			if err := gh.sendResult(context.Background(), tt.e, tt.msg, tt.succeeded); err != nil {
+				t.Errorf("ghClient.sendResult() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.sendResult() sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_afterMerge(t *testing.T) {
+	var labeled []string
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/labels") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		labeled = append(labeled, r.URL.Path)
+		w.Write([]byte(`[{"name":"merged-by-bot"}]`))
+	}))
+	var notified []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		notified = append(notified, p.PRNumber)
+	}))
+	defer srv.Close()
+	output := filepath.Join(t.TempDir(), "output")
+	e := env{Owner: "abema", Repo: "github-actions-merger", OutputFile: output, PostMergeLabel: "merged-by-bot", NotifyWebhookURL: srv.URL}
+	// pull requests of a batch merge in order.
+	for _, r := range []batchResult{
+		{prNumber: 12, result: &mergeResult{sha: "abc123"}},
+		{prNumber: 15, result: &mergeResult{queued: true}},
+	} {
+		pe := e
+		pe.PRNumber = r.prNumber
+		afterMerge(context.Background(), gh, pe, r.result)
+	}
+	// queued pull requests are not labeled yet.
+	if want := []string{"/repos/abema/github-actions-merger/issues/12/labels"}; !reflect.DeepEqual(labeled, want) {
+		t.Errorf("afterMerge() labeled %q, want %q", labeled, want)
+	}
+	if want := []int{12, 15}; !reflect.DeepEqual(notified, want) {
+		t.Errorf("afterMerge() notified %v, want %v", notified, want)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// outputs of the last pull request overwrite the earlier ones.
+	if want := "merge_sha=abc123\nmerge_queued=false\nmerge_sha=\nmerge_queued=true\n"; string(got) != want {
+		t.Errorf("afterMerge() wrote outputs %q, want %q", got, want)
+	}
+}
+
+func Test_ghClient_addLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{
+			name:   "added",
+			status: http.StatusOK,
+		},
+		{
+			name:    "forbidden",
+			status:  http.StatusForbidden,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/repos/abema/github-actions-merger/issues/1/labels" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{}`))
+					return
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Error(err)
+				}
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`[{"name":"merged-by-bot"}]`))
+			}))
+			err := gh.addLabel(context.Background(), "abema", "github-actions-merger", 1, "merged-by-bot")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.addLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, []string{"merged-by-bot"}) {
+				t.Errorf("ghClient.addLabel() sent %q", got)
+			}
+		})
+	}
+}
+
+func Test_truncateComment(t *testing.T) {
+	marker := successMarker(100)
+	tests := []struct {
+		name string
+		msg  string
+		max  int
+		want string
+	}{
+		{
+			name: "short message",
+			msg:  "Merged PR #1 successfully!",
+			max:  100,
+			want: "Merged PR #1 successfully!",
+		},
+		{
+			name: "truncated",
+			msg:  strings.Repeat("a", 30),
+			max:  20,
+			want: "aaaaaa…(truncated)",
+		},
+		{
+			name: "utf-8 characters are not broken",
+			msg:  strings.Repeat("あ", 10),
+			max:  21,
+			want: "ああ…(truncated)",
+		},
+		{
+			name: "markers are kept",
+			msg:  strings.Repeat("a", 100) + "\n" + marker + "\n",
+			max:  len(marker) + 30,
+			want: strings.Repeat("a", 15) + "…(truncated)\n" + marker,
+		},
+		{
+			name: "disabled",
+			msg:  strings.Repeat("a", 30),
+			want: strings.Repeat("a", 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateComment(tt.msg, tt.max)
+			if got != tt.want {
+				t.Errorf("truncateComment() = %q, want %q", got, tt.want)
+			}
+			if tt.max > 0 && len(got) > tt.max {
+				t.Errorf("truncateComment() is %d bytes, want at most %d", len(got), tt.max)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		resp    string
+		want    *mergeResult
+		wantErr bool
+	}{
+		{
+			name:   "merged",
+			status: http.StatusOK,
+			resp:   `{"sha":"merged","merged":true}`,
+			want:   &mergeResult{title: "title", mergeMethod: "squash", sha: "merged", headSHA: "head", releaseNotes: []string{"NONE"}},
+		},
+		{
+			name:    "conflict",
+			status:  http.StatusMethodNotAllowed,
+			resp:    `{"message":"Pull Request is not mergeable"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+					w.Write([]byte(`{"number":1,"title":"title","base":{"repo":{"name":"github-actions-merger","owner":{"login":"abema"}}},"head":{"sha":"head","ref":"feature","repo":{"name":"github-actions-merger","owner":{"login":"abema"}}}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+					w.Write([]byte(`[]`))
+				case r.Method == http.MethodPut && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/merge":
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.resp))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/git/refs/heads/feature":
+					w.Write([]byte(`{"ref":"refs/heads/feature"}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{}`))
+				}
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}
+			got, err := gh.merge(context.Background(), e, &command{mergeMethod: "squash"}, &templates{body: bodyTpl, subject: subjectTpl})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && failureReason(err) != reasonConflict {
+				t.Errorf("failureReason() = %v, want %v", failureReason(err), reasonConflict)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_afterCancel(t *testing.T) {
+	// auto merge was enabled by comment 100 and canceled by /merge cancel, then the same head is commented again.
+	comments := fmt.Sprintf(`[{"id":100,"body":"/merge"},{"id":101,"body":%q},{"id":102,"body":"/merge cancel"},{"id":103,"body":"Canceled auto merge of PR #1."},{"id":200,"body":"/merge"}]`,
+		mergeSummary(1, &mergeResult{mergeMethod: "squash", queued: true, headSHA: "head", commentID: 100}))
+	tests := []struct {
+		name          string
+		commentID     int64
+		wantDuplicate bool
+	}{
+		{
+			name:      "new comment on the same head is merged",
+			commentID: 200,
+		},
+		{
+			name:          "re-delivered comment is skipped",
+			commentID:     100,
+			wantDuplicate: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := false
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+					w.Write([]byte(`{"number":1,"title":"title","base":{"repo":{"name":"github-actions-merger","owner":{"login":"abema"}}},"head":{"sha":"head","ref":"feature","repo":{"name":"github-actions-merger","owner":{"login":"abema"}}}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+					w.Write([]byte(comments))
+				case r.Method == http.MethodPut && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/merge":
+					merged = true
+					w.Write([]byte(`{"sha":"merged","merged":true}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/git/refs/heads/feature":
+					w.Write([]byte(`{"ref":"refs/heads/feature"}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{}`))
+				}
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, CommentID: tt.commentID}
+			got, err := gh.merge(context.Background(), e, &command{mergeMethod: "squash"}, &templates{body: bodyTpl, subject: subjectTpl})
+			if err != nil {
+				t.Fatalf("ghClient.merge() error = %v", err)
+			}
+			if got.duplicate != tt.wantDuplicate || merged == tt.wantDuplicate {
+				t.Errorf("ghClient.merge() duplicate = %v, merged = %v, want duplicate %v", got.duplicate, merged, tt.wantDuplicate)
+			}
+			if !tt.wantDuplicate && !strings.Contains(mergeSummary(1, got), successMarker(200)) {
+				t.Errorf("mergeSummary() = %q, want the marker of comment 200", mergeSummary(1, got))
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_fallbackMergeMethod(t *testing.T) {
+	tests := []struct {
+		name       string
+		fallback   string
+		message    string
+		wantMethod []string
+		wantBody   string
+		want       *mergeResult
+		wantErr    bool
+	}{
+		{
+			name:       "retry with fallback",
+			fallback:   "merge",
+			wantMethod: []string{"squash", "merge"},
+			want:       &mergeResult{title: "title", mergeMethod: "merge", fallbackFrom: "squash", sha: "merged", headSHA: "head", releaseNotes: []string{"NONE"}},
+		},
+		{
+			name:       "message override is kept on fallback",
+			fallback:   "merge",
+			message:    "Fix the parser bug",
+			wantMethod: []string{"squash", "merge"},
+			wantBody:   "Fix the parser bug",
+			want:       &mergeResult{title: "title", mergeMethod: "merge", fallbackFrom: "squash", sha: "merged", headSHA: "head", releaseNotes: []string{"NONE"}},
+		},
+		{
+			name:       "no fallback",
+			wantMethod: []string{"squash"},
+			wantErr:    true,
+		},
+		{
+			name:       "fallback is the same method",
+			fallback:   "squash",
+			wantMethod: []string{"squash"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			var body string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+					w.Write([]byte(`{"number":1,"title":"title","base":{"repo":{"name":"github-actions-merger","owner":{"login":"abema"}}},"head":{"sha":"head","ref":"feature","repo":{"name":"github-actions-merger","owner":{"login":"abema"}}}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+					w.Write([]byte(`[]`))
+				case r.Method == http.MethodPut && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/merge":
+					var req struct {
+						MergeMethod   string `json:"merge_method"`
+						CommitMessage string `json:"commit_message"`
+					}
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Error(err)
+					}
+					methods, body = append(methods, req.MergeMethod), req.CommitMessage
+					if req.MergeMethod == "squash" {
+						w.WriteHeader(http.StatusMethodNotAllowed)
+						w.Write([]byte(`{"message":"Squash merges are not allowed on this repository."}`))
+						return
+					}
+					w.Write([]byte(`{"sha":"merged","merged":true}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/git/refs/heads/feature":
+					w.Write([]byte(`{"ref":"refs/heads/feature"}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, FallbackMergeMethod: tt.fallback}
+			got, err := gh.merge(context.Background(), e, &command{mergeMethod: "squash", message: tt.message}, &templates{body: bodyTpl, subject: subjectTpl})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(methods, tt.wantMethod) {
+				t.Errorf("ghClient.merge() merged with %v, want %v", methods, tt.wantMethod)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("ghClient.merge() merged with body %q, want %q", body, tt.wantBody)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_linearHistory(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		wantMethod []string
+		want       *mergeResult
+		wantErr    bool
+	}{
+		{
+			name:       "switch to the linear history merge method",
+			method:     "rebase",
+			wantMethod: []string{"rebase"},
+			want:       &mergeResult{title: "title", mergeMethod: "rebase", fallbackFrom: "merge", sha: "merged", headSHA: "head", releaseNotes: []string{"NONE"}},
+		},
+		{
+			name:    "refuse merge commits",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+					w.Write([]byte(`{"number":1,"title":"title","base":{"ref":"main","repo":{"name":"github-actions-merger","owner":{"login":"abema"}}},"head":{"sha":"head","ref":"feature","repo":{"name":"github-actions-merger","owner":{"login":"abema"}}}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+					w.Write([]byte(`[]`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/branches/main/protection":
+					w.Write([]byte(`{"required_linear_history":{"enabled":true}}`))
+				case r.Method == http.MethodPut && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/merge":
+					var req struct {
+						MergeMethod string `json:"merge_method"`
+					}
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						t.Error(err)
+					}
+					methods = append(methods, req.MergeMethod)
+					w.Write([]byte(`{"sha":"merged","merged":true}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/git/refs/heads/feature":
+					w.Write([]byte(`{"ref":"refs/heads/feature"}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, LinearHistoryMergeMethod: tt.method}
+			got, err := gh.merge(context.Background(), e, &command{mergeMethod: "merge"}, &templates{body: bodyTpl, subject: subjectTpl})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(methods, tt.wantMethod) {
+				t.Errorf("ghClient.merge() merged with %v, want %v", methods, tt.wantMethod)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_waitForApproval(t *testing.T) {
+	tests := []struct {
+		name            string
+		waitForApproval bool
+		protection      string
+		want            *mergeResult
+		wantErr         bool
+	}{
+		{
+			name:            "queue pending approval",
+			waitForApproval: true,
+			protection:      `{"required_pull_request_reviews":{"required_approving_review_count":1}}`,
+			want: &mergeResult{
+				title:            "title",
+				mergeMethod:      "squash",
+				queued:           true,
+				headSHA:          "head",
+				releaseNotes:     []string{"NONE"},
+				pendingApprovals: []string{"need 1 approvals, have 0"},
+			},
+		},
+		{
+			name:    "refuse without approval",
+			wantErr: true,
+		},
+		{
+			name:            "refuse if branch protection requires less approvals",
+			waitForApproval: true,
+			protection:      `{"required_pull_request_reviews":{"required_approving_review_count":0}}`,
+			wantErr:         true,
+		},
+		{
+			name:            "refuse if branch protection is not readable",
+			waitForApproval: true,
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubCommand(t, "", "0")
+			orig := lookPath
+			t.Cleanup(func() { lookPath = orig })
+			lookPath = func(file string) (string, error) { return "/usr/bin/gh", nil }
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+					w.Write([]byte(`{"number":1,"title":"title","base":{"ref":"main"},"head":{"sha":"head","ref":"feature"}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+					w.Write([]byte(`[]`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/reviews":
+					w.Write([]byte(`[]`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/branches/main/protection":
+					if tt.protection == "" {
+						w.WriteHeader(http.StatusForbidden)
+						w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+						return
+					}
+					w.Write([]byte(tt.protection))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, MinApprovals: 1, WaitForApproval: tt.waitForApproval}
+			got, err := gh.merge(context.Background(), e, &command{mergeMethod: "squash"}, &templates{body: bodyTpl, subject: subjectTpl})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ghClient.merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ghClient.merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_merge_notAssignee(t *testing.T) {
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/repos/abema/github-actions-merger/pulls/1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"number":1,"title":"title","assignees":[{"login":"na-ga"}],"head":{"sha":"head"}}`))
+	}))
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, Actor: "octocat", AllowAssignees: true}
+	unauthorized := &unauthorizedError{actor: "octocat", mergers: []string{"0daryo"}, assignees: true}
+	_, err := gh.merge(context.Background(), e, &command{mergeMethod: "merge", unauthorized: unauthorized}, &templates{body: bodyTpl, subject: subjectTpl})
+	if err != unauthorized {
+		t.Errorf("ghClient.merge() error = %v, want %v", err, unauthorized)
+	}
+}
+
+func Test_ghClient_merge_outsideWindow(t *testing.T) {
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+			w.Write([]byte(`{"number":1,"title":"title","base":{"ref":"main"},"head":{"sha":"head","ref":"feature"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+			w.Write([]byte(`[]`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	// the window is only on a day other than today.
+	day := ((time.Now().UTC().Weekday() + 3) % 7).String()[:3]
+	var window mergeWindow
+	if err := window.Decode(day + " 09:00-17:00"); err != nil {
+		t.Fatal(err)
+	}
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, MergeWindow: window}
+	_, err := gh.merge(context.Background(), e, &command{mergeMethod: "merge"}, &templates{body: bodyTpl, subject: subjectTpl})
+	if got := failureReason(err); got != reasonOutsideWindow {
+		t.Errorf("ghClient.merge() error = %v, want reason %s", err, reasonOutsideWindow)
+	}
+}
+
+func Test_ghClient_merge_assigneeNotAutoApproved(t *testing.T) {
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1":
+			w.Write([]byte(`{"number":1,"title":"title","assignees":[{"login":"octocat"}],"base":{"repo":{"name":"github-actions-merger","owner":{"login":"abema"}}},"head":{"sha":"head","ref":"feature","repo":{"name":"github-actions-merger","owner":{"login":"abema"}}}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments":
+			w.Write([]byte(`[]`))
+		case r.Method == http.MethodPut && r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/merge":
+			w.Write([]byte(`{"sha":"merged","merged":true}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/git/refs/heads/feature":
+			w.Write([]byte(`{"ref":"refs/heads/feature"}`))
+		default:
+			// reviews are neither listed nor created for assignees.
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, Actor: "octocat", Mergers: []string{"0daryo"}, AllowAssignees: true, AutoApprove: true}
+	unauthorized := &unauthorizedError{actor: "octocat", mergers: []string{"0daryo"}, assignees: true}
+	got, err := gh.merge(context.Background(), e, &command{mergeMethod: "squash", unauthorized: unauthorized}, &templates{body: bodyTpl, subject: subjectTpl})
+	if err != nil {
+		t.Fatalf("ghClient.merge() error = %v", err)
+	}
+	if got.approvedBy != "" {
+		t.Errorf("ghClient.merge() approved by %s, want no approval", got.approvedBy)
 	}
 }
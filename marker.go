@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// successMarker returns a hidden marker embedded in the success message of the trigger comment,
+// to detect the comment was already handled when the event is re-delivered.
+// it is keyed by the comment rather than the head, so that later comments on the same head, e.g. after auto merge is canceled, are still handled.
+func successMarker(commentID int64) string {
+	return fmt.Sprintf("<!-- github-actions-merger:success comment=%d -->", commentID)
+}
+
+// hasSucceeded returns whether a success message for the trigger comment was already posted on the pull request.
+// re-delivered events cannot be detected without the comment id.
+func (gh *ghClient) hasSucceeded(ctx context.Context, owner, repo string, prNumber int, commentID int64) (bool, error) {
+	if commentID == 0 {
+		return false, nil
+	}
+	marker := successMarker(commentID)
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := gh.client.Issues.ListComments(ctx, owner, repo, prNumber, opt)
+		if err != nil {
+			return false, fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if strings.Contains(c.GetBody(), marker) {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func Test_ghClient_hasSucceeded(t *testing.T) {
+	tests := []struct {
+		name      string
+		commentID int64
+		want      bool
+	}{
+		{
+			name:      "success message of the comment",
+			commentID: 100,
+			want:      true,
+		},
+		{
+			name:      "success message of another comment",
+			commentID: 200,
+		},
+		{
+			name: "without comment id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := map[string]string{
+				"":  `[{"body":"/merge"}]`,
+				"2": fmt.Sprintf(`[{"body":%q}]`, "Merged PR #1 successfully!\n"+successMarker(100)),
+			}
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.commentID == 0 {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+				}
+				w.Write([]byte(pages[page]))
+			}))
+			got, err := gh.hasSucceeded(context.Background(), "abema", "github-actions-merger", 1, tt.commentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.hasSucceeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	// outcomePending is the outcome of progress comments of steps which are still waiting.
+	outcomePending = "pending"
+)
+
+// messageFields are fields of the message template.
+type messageFields struct {
+	// Outcome is success, failure or pending.
+	Outcome string
+	Number  int
+	// Reason is the failure reason code. empty on success and for batch merges, whose pull requests fail for different reasons.
+	Reason string
+	Actor  string
+	// Message is the plain message which is posted without the template.
+	Message string
+}
+
+// sampleMessage is used to validate the message template before merge.
+var sampleMessage = messageFields{
+	Outcome: outcomeFailure,
+	Number:  1,
+	Reason:  reasonUnknown,
+	Actor:   "octocat",
+	Message: "message",
+}
+
+// hiddenMarkerRegexp matches hidden markers embedded in messages .e.g. the success marker.
+var hiddenMarkerRegexp = regexp.MustCompile(`<!-- github-actions-merger:[^>]*-->`)
+
+// parseMessageTemplate parses the message template, and executes it with sample fields to detect references to unknown fields.
+func parseMessageTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tpl.Execute(&strings.Builder{}, sampleMessage); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// renderMessage returns msg posted to the pull request, rendered with MESSAGE_TEMPLATE if specified, otherwise decorated.
+// reason is the failure reason code, which is empty on success.
+// hidden markers of msg are kept even if the template omits the message, so that re-delivered events are still detected.
+func renderMessage(e env, msg string, succeeded bool, reason string) string {
+	outcome := outcomeFailure
+	if succeeded {
+		outcome = outcomeSuccess
+	}
+	return renderOutcome(e, msg, outcome, reason)
+}
+
+// renderOutcome renders msg like renderMessage, including pending outcomes of progress comments.
+func renderOutcome(e env, msg, outcome, reason string) string {
+	if e.MessageTemplate == "" {
+		return decorateOutcome(e, msg, outcome)
+	}
+	tpl, err := parseMessageTemplate(e.MessageTemplate)
+	if err != nil {
+		// invalid templates are refused by loadTemplates, but failures before it are still posted.
+		logger.Warnf("invalid message template, fallback to the plain message: %v", err)
+		return decorateOutcome(e, msg, outcome)
+	}
+	f := messageFields{Outcome: outcome, Number: e.PRNumber, Reason: reason, Actor: e.Actor, Message: msg}
+	var b strings.Builder
+	if err := tpl.Execute(&b, f); err != nil {
+		logger.Warnf("failed to render message template, fallback to the plain message: %v", err)
+		return decorateOutcome(e, msg, outcome)
+	}
+	out := b.String()
+	for _, m := range hiddenMarkerRegexp.FindAllString(msg, -1) {
+		if !strings.Contains(out, m) {
+			out += "\n" + m + "\n"
+		}
+	}
+	return out
+}
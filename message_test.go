@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func Test_renderMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		tpl       string
+		msg       string
+		succeeded bool
+		reason    string
+		want      string
+	}{
+		{
+			name:      "no template",
+			msg:       "Merged PR #1 successfully!",
+			succeeded: true,
+			want:      "✅ Merged PR #1 successfully!",
+		},
+		{
+			name:   "failure",
+			tpl:    "{{ if eq .Outcome \"failure\" }}@{{ .Actor }} マージできませんでした (#{{ .Number }}, {{ .Reason }}): {{ .Message }}{{ end }}",
+			msg:    "Need 1 approving review",
+			reason: reasonApprovalsRequired,
+			want:   "@octocat マージできませんでした (#1, approvals_required): Need 1 approving review",
+		},
+		{
+			name:      "success keeps the marker",
+			tpl:       "{{ .Outcome }}: #{{ .Number }}",
+			msg:       "Merged PR #1 successfully!\n" + successMarker(100) + "\n",
+			succeeded: true,
+			want:      "success: #1\n" + successMarker(100) + "\n",
+		},
+		{
+			name:      "marker in the message is not duplicated",
+			tpl:       "{{ .Message }}",
+			msg:       "Merged PR #1 successfully!\n" + successMarker(100) + "\n",
+			succeeded: true,
+			want:      "Merged PR #1 successfully!\n" + successMarker(100) + "\n",
+		},
+		{
+			name: "invalid template falls back",
+			tpl:  "{{ .Title }}",
+			msg:  "Need 1 approving review",
+			want: "❌ Need 1 approving review",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := env{PRNumber: 1, Actor: "octocat", Emoji: true, ErrorPrefix: "❌", MessageTemplate: tt.tpl}
+			if got := renderMessage(e, tt.msg, tt.succeeded, tt.reason); got != tt.want {
+				t.Errorf("renderMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// metrics records the duration of the run and the number of github api requests.
+type metrics struct {
+	start    time.Time
+	apiCalls int64
+}
+
+func newMetrics(start time.Time) *metrics {
+	return &metrics{start: start}
+}
+
+// transport returns base counting every request sent through it.
+func (m *metrics) transport(base http.RoundTripper) http.RoundTripper {
+	return &countingTransport{base: base, m: m}
+}
+
+// countingTransport counts requests including retries, so that calls consumed from the rate limit are reported.
+type countingTransport struct {
+	base http.RoundTripper
+	m    *metrics
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.m.apiCalls, 1)
+	return t.base.RoundTrip(req)
+}
+
+// summary returns the one-line summary of the metrics at now.
+func (m *metrics) summary(now time.Time) string {
+	return fmt.Sprintf("merger took %s with %d GitHub API calls", now.Sub(m.start).Round(time.Millisecond), atomic.LoadInt64(&m.apiCalls))
+}
+
+// report prints the summary to w, and appends it to the step summary file if path is not empty.
+// GitHub docs: https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#adding-a-job-summary
+func (m *metrics) report(w io.Writer, path string, now time.Time) error {
+	s := m.summary(now)
+	fmt.Fprintln(w, s)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open step summary file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s + "\n"); err != nil {
+		return fmt.Errorf("failed to write step summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_metrics_transport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	m := newMetrics(time.Now())
+	client := &http.Client{Transport: m.transport(http.DefaultTransport)}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if m.apiCalls != 3 {
+		t.Errorf("metrics.transport() counted %d calls, want 3", m.apiCalls)
+	}
+}
+
+func Test_metrics_report(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := "merger took 2.5s with 7 GitHub API calls\n"
+	tests := []struct {
+		name        string
+		stepSummary bool
+	}{
+		{
+			name: "stdout only",
+		},
+		{
+			name:        "with step summary",
+			stepSummary: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metrics{start: start, apiCalls: 7}
+			var path string
+			if tt.stepSummary {
+				path = filepath.Join(t.TempDir(), "summary")
+				if err := os.WriteFile(path, []byte("existing\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var out strings.Builder
+			if err := m.report(&out, path, start.Add(2500*time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != want {
+				t.Errorf("metrics.report() printed %q, want %q", out.String(), want)
+			}
+			if !tt.stepSummary {
+				return
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "existing\n"+want {
+				t.Errorf("metrics.report() wrote %q, want %q", got, "existing\n"+want)
+			}
+		})
+	}
+}
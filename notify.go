@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// webhookTimeout is independent of the job timeout so that a slow webhook does not hold the job.
+	webhookTimeout = 10 * time.Second
+	// signatureHeader is the header of HMAC-SHA256 signature of the payload, in the same format as github webhooks.
+	signatureHeader = "X-Merger-Signature-256"
+)
+
+// webhookPayload is a payload posted to NOTIFY_WEBHOOK_URL after merge.
+type webhookPayload struct {
+	Repository  string `json:"repository"`
+	PRNumber    int    `json:"pr_number"`
+	Title       string `json:"title"`
+	MergeSHA    string `json:"merge_sha"`
+	Queued      bool   `json:"queued"`
+	Actor       string `json:"actor"`
+	MergeMethod string `json:"merge_method"`
+}
+
+// notifyWebhook posts the payload to url as JSON.
+// if secret is not empty, the payload is signed with HMAC-SHA256.
+func notifyWebhook(url, secret string, p webhookPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	header := http.Header{}
+	if secret != "" {
+		header.Set(signatureHeader, "sha256="+sign(secret, body))
+	}
+	if err := postJSON(url, body, header); err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	return nil
+}
+
+// postJSON posts body to url as JSON with header, and returns error unless the response status is 2xx.
+func postJSON(url string, body []byte, header http.Header) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sign returns hex encoded HMAC-SHA256 of body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_notifyWebhook(t *testing.T) {
+	payload := webhookPayload{
+		Repository:  "abema/github-actions-merger",
+		PRNumber:    1,
+		Title:       "pull request title",
+		MergeSHA:    "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+		Actor:       "0daryo",
+		MergeMethod: "squash",
+	}
+	tests := []struct {
+		name          string
+		secret        string
+		status        int
+		wantSignature bool
+		wantErr       bool
+	}{
+		{
+			name:   "without secret",
+			status: http.StatusOK,
+		},
+		{
+			name:          "with secret",
+			secret:        "secret",
+			status:        http.StatusNoContent,
+			wantSignature: true,
+		},
+		{
+			name:    "error status",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				var got webhookPayload
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Errorf("failed to unmarshal payload: %v", err)
+				}
+				if got != payload {
+					t.Errorf("payload = %+v, want %+v", got, payload)
+				}
+				sig := r.Header.Get(signatureHeader)
+				if tt.wantSignature && sig != "sha256="+sign(tt.secret, body) {
+					t.Errorf("signature = %q, want signature of the body", sig)
+				}
+				if !tt.wantSignature && sig != "" {
+					t.Errorf("signature = %q, want empty", sig)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			if err := notifyWebhook(srv.URL, tt.secret, payload); (err != nil) != tt.wantErr {
+				t.Errorf("notifyWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_notifyWebhook_unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if err := notifyWebhook(srv.URL, "", webhookPayload{}); err == nil {
+		t.Errorf("notifyWebhook() error = nil, want error")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// writeOutputs appends outputs of the merge result to the GITHUB_OUTPUT file.
+// both outputs are always written, so that outputs of earlier pull requests of batch merges are overwritten.
+// merge_sha is empty when queued since no sha is known yet.
+// GitHub docs: https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#setting-an-output-parameter
+func writeOutputs(path string, r *mergeResult) error {
+	return appendOutputs(path, fmt.Sprintf("merge_sha=%s\nmerge_queued=%t\n", r.sha, r.queued))
+}
+
+// writeFailureReason appends failure_reason output to the GITHUB_OUTPUT file.
+func writeFailureReason(path, reason string) error {
+	return appendOutputs(path, fmt.Sprintf("failure_reason=%s\n", reason))
+}
+
+// appendOutputs appends lines of outputs to the file.
+func appendOutputs(path, out string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(out); err != nil {
+		return fmt.Errorf("failed to write outputs: %w", err)
+	}
+	return nil
+}
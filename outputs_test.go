@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_writeOutputs(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *mergeResult
+		want   string
+	}{
+		{
+			name:   "merged",
+			result: &mergeResult{sha: "abc123"},
+			want:   "existing=value\nmerge_sha=abc123\nmerge_queued=false\n",
+		},
+		{
+			name:   "queued",
+			result: &mergeResult{queued: true},
+			want:   "existing=value\nmerge_sha=\nmerge_queued=true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "output")
+			if err := os.WriteFile(path, []byte("existing=value\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeOutputs(path, tt.result); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("writeOutputs() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeFailureReason(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	if err := writeFailureReason(path, reasonConflict); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "failure_reason=conflict\n"; string(got) != want {
+		t.Errorf("writeFailureReason() wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// protectedPath returns the first file of the pull request which matches any of globs.
+func (gh *ghClient) protectedPath(ctx context.Context, owner, repo string, prNumber int, globs []string) (string, bool, error) {
+	patterns := make([]*regexp.Regexp, 0, len(globs))
+	for _, g := range globs {
+		patterns = append(patterns, globRegexp(g))
+	}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := gh.client.PullRequests.ListFiles(ctx, owner, repo, prNumber, opt)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, f := range files {
+			for _, p := range patterns {
+				if p.MatchString(f.GetFilename()) {
+					return f.GetFilename(), true, nil
+				}
+			}
+		}
+		if resp.NextPage == 0 {
+			return "", false, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// globRegexp converts glob into regexp matching whole paths.
+// `*` matches any characters except `/`, `**` matches any characters including `/`, and `?` matches a character except `/`.
+func globRegexp(glob string) *regexp.Regexp {
+	return regexp.MustCompile("^" + globPattern(glob) + "$")
+}
+
+// globPattern returns the unanchored regexp of glob converted like globRegexp.
+func globPattern(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func Test_globRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{glob: "infra/**", path: "infra/prod/main.tf", want: true},
+		{glob: "infra/*", path: "infra/prod/main.tf", want: false},
+		{glob: "infra/*", path: "infra/main.tf", want: true},
+		{glob: "*.lock", path: "go.lock", want: true},
+		{glob: "*.lock", path: "sub/go.lock", want: false},
+		{glob: "**/*.lock", path: "sub/go.lock", want: true},
+		{glob: ".github/workflows/?.yml", path: ".github/workflows/a.yml", want: true},
+		{glob: "go.mod", path: "go.mod", want: true},
+		{glob: "go.mod", path: "go.mod.bak", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			if got := globRegexp(tt.glob).MatchString(tt.path); got != tt.want {
+				t.Errorf("globRegexp(%q).MatchString(%q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_protectedPath(t *testing.T) {
+	pages := map[string]string{
+		"":  `[{"filename":"README.md"},{"filename":"main.go"}]`,
+		"2": `[{"filename":"infra/prod/main.tf"}]`,
+	}
+	tests := []struct {
+		name   string
+		globs  []string
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "protected path in the second page",
+			globs:  []string{"infra/**"},
+			want:   "infra/prod/main.tf",
+			wantOk: true,
+		},
+		{
+			name:  "no protected path",
+			globs: []string{"secrets/**", "*.lock"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+				}
+				w.Write([]byte(pages[page]))
+			}))
+			got, ok, err := gh.protectedPath(context.Background(), "abema", "github-actions-merger", 1, tt.globs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ghClient.protectedPath() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commitPreview returns a message previewing the commit subject and body merged with mergeMethod, which remains as an audit trail.
+func commitPreview(mergeMethod, subject, body string) string {
+	msg := subject + "\n\n" + body
+	// commit messages may contain code blocks of the pull request description, so the fence is longer than any of them.
+	fence := strings.Repeat("`", longestRun(msg, '`')+1)
+	if len(fence) < 3 {
+		fence = "```"
+	}
+	return fmt.Sprintf("Merging with %s as the following commit message:\n\n%s\n%s\n%s", mergeMethod, fence, strings.TrimRight(msg, "\n"), fence)
+}
+
+// longestRun returns the length of the longest run of c in s.
+func longestRun(s string, c byte) int {
+	longest, n := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != c {
+			n = 0
+			continue
+		}
+		n++
+		if n > longest {
+			longest = n
+		}
+	}
+	return longest
+}
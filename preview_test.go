@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func Test_commitPreview(t *testing.T) {
+	tests := []struct {
+		name        string
+		mergeMethod string
+		subject     string
+		body        string
+		want        string
+	}{
+		{
+			name:        "plain message",
+			mergeMethod: "squash",
+			subject:     "Add feature (#1)",
+			body:        "description\n",
+			want:        "Merging with squash as the following commit message:\n\n```\nAdd feature (#1)\n\ndescription\n```",
+		},
+		{
+			name:        "message with code block",
+			mergeMethod: "merge",
+			subject:     "Add feature (#1)",
+			body:        "```go\nfmt.Println()\n```",
+			want:        "Merging with merge as the following commit message:\n\n````\nAdd feature (#1)\n\n```go\nfmt.Println()\n```\n````",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commitPreview(tt.mergeMethod, tt.subject, tt.body); got != tt.want {
+				t.Errorf("commitPreview() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
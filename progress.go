@@ -0,0 +1,49 @@
+package main
+
+import "context"
+
+// progress is a single comment reporting progress of a step which waits for the pull request, e.g. for its checks.
+// the comment is updated while waiting and with the outcome on completion, so that the timeline is not flooded.
+type progress struct {
+	gh       *ghClient
+	e        env
+	prNumber int
+	// id is the id of the comment, zero if it failed to be posted.
+	id int64
+}
+
+// startProgress posts msg as a pending progress comment on the pull request.
+// progress is informational, so failures are only logged and later updates are skipped.
+func (gh *ghClient) startProgress(ctx context.Context, e env, prNumber int, msg string) *progress {
+	p := &progress{gh: gh, e: e, prNumber: prNumber}
+	c, err := gh.postComment(ctx, e.Owner, e.Repo, prNumber, renderOutcome(e, msg, outcomePending, ""))
+	if err != nil {
+		logger.Warnf("%v", err)
+		return p
+	}
+	p.id = c.GetID()
+	return p
+}
+
+// update replaces the message of the comment while still waiting.
+func (p *progress) update(ctx context.Context, msg string) {
+	p.edit(ctx, renderOutcome(p.e, msg, outcomePending, ""))
+}
+
+// finish replaces the message of the comment with the outcome of the step. err is the failure of the step, nil on success.
+func (p *progress) finish(ctx context.Context, msg string, err error) {
+	if err != nil {
+		p.edit(ctx, renderOutcome(p.e, msg, outcomeFailure, failureReason(err)))
+		return
+	}
+	p.edit(ctx, renderOutcome(p.e, msg, outcomeSuccess, ""))
+}
+
+func (p *progress) edit(ctx context.Context, body string) {
+	if p.id == 0 {
+		return
+	}
+	if err := p.gh.editComment(ctx, p.e.Owner, p.e.Repo, p.id, body); err != nil {
+		logger.Warnf("%v", err)
+	}
+}
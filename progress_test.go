@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_ghClient_startProgress(t *testing.T) {
+	tests := []struct {
+		name         string
+		e            env
+		err          error
+		max          int
+		wantComments []string
+	}{
+		{
+			name: "succeeded with emoji",
+			e:    env{Emoji: true, ErrorPrefix: "❌"},
+			wantComments: []string{
+				"⏳ Waiting.",
+				"⏳ Still waiting.",
+				"✅ Done.",
+			},
+		},
+		{
+			name: "failed with emoji",
+			e:    env{Emoji: true, ErrorPrefix: "❌"},
+			err:  withReason(reasonChecksFailed, errors.New("failed")),
+			wantComments: []string{
+				"⏳ Waiting.",
+				"⏳ Still waiting.",
+				"❌ Done.",
+			},
+		},
+		{
+			name: "message template",
+			e:    env{MessageTemplate: "{{ .Outcome }}/{{ .Reason }}: {{ .Message }}"},
+			err:  withReason(reasonChecksFailed, errors.New("failed")),
+			wantComments: []string{
+				"pending/: Waiting.",
+				"pending/: Still waiting.",
+				"failure/checks_failed: Done.",
+			},
+		},
+		{
+			name: "truncated",
+			max:  len("Waiting.") + len(truncatedSuffix) - 2,
+			wantComments: []string{
+				truncateComment("Waiting.", len("Waiting.")+len(truncatedSuffix)-2),
+				"Still waiting.",
+				truncateComment("Done.", len("Waiting.")+len(truncatedSuffix)-2),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var comments []string
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments",
+					r.Method == http.MethodPatch && r.URL.Path == "/repos/abema/github-actions-merger/issues/comments/10":
+					var c github.IssueComment
+					json.NewDecoder(r.Body).Decode(&c)
+					comments = append(comments, c.GetBody())
+					w.Write([]byte(`{"id":10}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			gh.maxCommentBytes = tt.max
+			e := tt.e
+			e.Owner, e.Repo, e.PRNumber = "abema", "github-actions-merger", 1
+			p := gh.startProgress(context.Background(), e, 1, "Waiting.")
+			p.update(context.Background(), "Still waiting.")
+			p.finish(context.Background(), "Done.", tt.err)
+			if !reflect.DeepEqual(comments, tt.wantComments) {
+				t.Errorf("comments = %q, want %q", comments, tt.wantComments)
+			}
+			for _, c := range comments {
+				if tt.max > 0 && len(c) > tt.max {
+					t.Errorf("comment %q is longer than %d bytes", c, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func Test_ghClient_startProgress_notPosted(t *testing.T) {
+	calls := 0
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+	}))
+	p := gh.startProgress(context.Background(), env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}, 1, "Waiting.")
+	p.update(context.Background(), "Still waiting.")
+	p.finish(context.Background(), "Done.", nil)
+	// updates are skipped since the comment is not posted.
+	if calls != 1 {
+		t.Errorf("requested %d times, want 1", calls)
+	}
+}
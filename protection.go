@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// protection is the part of branch protection which merger depends on.
+// the zero value is used if the branch is not protected or the token cannot read the protection.
+type protection struct {
+	linearHistory    bool
+	approvals        int
+	codeOwnerReviews bool
+}
+
+// branchProtection returns the protection of the branch. the result is cached within a run.
+// GitHub API docs: https://docs.github.com/en/rest/branches/branch-protection#get-branch-protection
+func (gh *ghClient) branchProtection(ctx context.Context, owner, repo, branch string) (protection, error) {
+	if v, ok := gh.protections[branch]; ok {
+		return v, nil
+	}
+	// go-github does not support required_linear_history.
+	req, err := gh.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/branches/%s/protection", owner, repo, branch), nil)
+	if err != nil {
+		return protection{}, err
+	}
+	var p struct {
+		RequiredLinearHistory struct {
+			Enabled bool `json:"enabled"`
+		} `json:"required_linear_history"`
+		RequiredPullRequestReviews struct {
+			RequiredApprovingReviewCount int  `json:"required_approving_review_count"`
+			RequireCodeOwnerReviews      bool `json:"require_code_owner_reviews"`
+		} `json:"required_pull_request_reviews"`
+	}
+	if _, err := gh.client.Do(ctx, req, &p); err != nil {
+		// reading branch protection requires admin permission.
+		if !hasStatus(err, http.StatusNotFound, http.StatusForbidden) {
+			return protection{}, fmt.Errorf("failed to get branch protection: %w", err)
+		}
+	}
+	v := protection{
+		linearHistory:    p.RequiredLinearHistory.Enabled,
+		approvals:        p.RequiredPullRequestReviews.RequiredApprovingReviewCount,
+		codeOwnerReviews: p.RequiredPullRequestReviews.RequireCodeOwnerReviews,
+	}
+	gh.protections[branch] = v
+	return v, nil
+}
+
+// requiresLinearHistory returns whether the protection of the branch requires linear history, which refuses merge commits.
+// false is returned if the branch is not protected or the token cannot read the protection.
+func (gh *ghClient) requiresLinearHistory(ctx context.Context, owner, repo, branch string) (bool, error) {
+	p, err := gh.branchProtection(ctx, owner, repo, branch)
+	if err != nil {
+		return false, err
+	}
+	return p.linearHistory, nil
+}
+
+// enforcesApprovals returns whether the protection of the branch requires at least approvals approving reviews,
+// and code owner reviews if codeOwners is true, so that auto merge does not merge before they land.
+// false is returned if the branch is not protected or the token cannot read the protection.
+func (gh *ghClient) enforcesApprovals(ctx context.Context, owner, repo, branch string, approvals int, codeOwners bool) (bool, error) {
+	p, err := gh.branchProtection(ctx, owner, repo, branch)
+	if err != nil {
+		return false, err
+	}
+	return p.approvals >= approvals && (p.codeOwnerReviews || !codeOwners), nil
+}
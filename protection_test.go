@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func Test_ghClient_requiresLinearHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "required",
+			status: http.StatusOK,
+			body:   `{"required_linear_history":{"enabled":true}}`,
+			want:   true,
+		},
+		{
+			name:   "not required",
+			status: http.StatusOK,
+			body:   `{"required_linear_history":{"enabled":false}}`,
+		},
+		{
+			name:   "not protected",
+			status: http.StatusNotFound,
+			body:   `{"message":"Branch not protected"}`,
+		},
+		{
+			name:   "no permission",
+			status: http.StatusForbidden,
+			body:   `{"message":"Resource not accessible by integration"}`,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    `{"message":"Server Error"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/abema/github-actions-merger/branches/main/protection" {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				calls++
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			for i := 0; i < 2; i++ {
+				got, err := gh.requiresLinearHistory(context.Background(), "abema", "github-actions-merger", "main")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ghClient.requiresLinearHistory() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("ghClient.requiresLinearHistory() = %v, want %v", got, tt.want)
+				}
+			}
+			// errors are not cached.
+			wantCalls := 1
+			if tt.wantErr {
+				wantCalls = 2
+			}
+			if calls != wantCalls {
+				t.Errorf("ghClient.requiresLinearHistory() requested %d times, want %d", calls, wantCalls)
+			}
+		})
+	}
+}
+
+func Test_ghClient_enforcesApprovals(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		approvals  int
+		codeOwners bool
+		want       bool
+	}{
+		{
+			name:      "enough approvals required",
+			status:    http.StatusOK,
+			body:      `{"required_pull_request_reviews":{"required_approving_review_count":2}}`,
+			approvals: 2,
+			want:      true,
+		},
+		{
+			name:      "less approvals required",
+			status:    http.StatusOK,
+			body:      `{"required_pull_request_reviews":{"required_approving_review_count":1}}`,
+			approvals: 2,
+		},
+		{
+			name:       "code owner reviews required",
+			status:     http.StatusOK,
+			body:       `{"required_pull_request_reviews":{"require_code_owner_reviews":true}}`,
+			codeOwners: true,
+			want:       true,
+		},
+		{
+			name:       "code owner reviews not required",
+			status:     http.StatusOK,
+			body:       `{"required_pull_request_reviews":{"required_approving_review_count":1}}`,
+			codeOwners: true,
+		},
+		{
+			name:      "no permission",
+			status:    http.StatusForbidden,
+			body:      `{"message":"Resource not accessible by integration"}`,
+			approvals: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/abema/github-actions-merger/branches/main/protection" {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			got, err := gh.enforcesApprovals(context.Background(), "abema", "github-actions-merger", "main", tt.approvals, tt.codeOwners)
+			if err != nil {
+				t.Fatalf("ghClient.enforcesApprovals() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ghClient.enforcesApprovals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
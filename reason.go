@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/google/go-github/github"
+)
+
+// failure reasons written to the failure_reason output.
+// values are part of the interface of the action since workflows branch on them, so never change them.
+const (
+	reasonUnauthorized            = "unauthorized"
+	reasonInvalidConfig           = "invalid_config"
+	reasonRateLimited             = "rate_limited"
+	reasonBlockedLabel            = "blocked_label"
+	reasonMissingLabels           = "missing_labels"
+	reasonTooNew                  = "too_new"
+	reasonProtectedPath           = "protected_path"
+	reasonTooLarge                = "too_large"
+	reasonFork                    = "fork"
+	reasonLinkedIssueRequired     = "linked_issue_required"
+	reasonLinearHistory           = "linear_history"
+	reasonBehindBase              = "behind_base"
+	reasonDraft                   = "draft"
+	reasonConflict                = "conflict"
+	reasonChecksPending           = "checks_pending"
+	reasonChecksFailed            = "checks_failed"
+	reasonDeploymentPending       = "deployment_pending"
+	reasonDeploymentFailed        = "deployment_failed"
+	reasonApprovalsRequired       = "approvals_required"
+	reasonCodeOwnersRequired      = "codeowners_required"
+	reasonUnresolvedConversations = "unresolved_conversations"
+	reasonHeadModified            = "head_modified"
+	reasonBaseModified            = "base_modified"
+	reasonMethodNotAllowed        = "method_not_allowed"
+	reasonAmbiguousMethod         = "ambiguous_method"
+	reasonOutsideWindow           = "outside_window"
+	reasonUnknown                 = "unknown"
+)
+
+// reasonError is an error classified with a failure reason where it is returned.
+type reasonError struct {
+	reason string
+	err    error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+// withReason classifies err with reason.
+func withReason(reason string, err error) error {
+	return &reasonError{reason: reason, err: err}
+}
+
+// failureReason returns the failure reason of err.
+// errors from github are classified by the same detection as errMsg.
+func failureReason(err error) string {
+	var reerr *reasonError
+	if errors.As(err, &reerr) {
+		return reerr.reason
+	}
+	var rerr *github.RateLimitError
+	if errors.As(err, &rerr) || isAbuseRateLimit(err) {
+		return reasonRateLimited
+	}
+	var uerr *unauthorizedError
+	if errors.As(err, &uerr) {
+		return reasonUnauthorized
+	}
+	var perr *pendingChecksError
+	if errors.As(err, &perr) {
+		return reasonChecksPending
+	}
+	switch {
+	case needApproveRegexp.MatchString(err.Error()):
+		return reasonApprovalsRequired
+	case isConflict(err):
+		return reasonConflict
+	case headModifiedRegexp.MatchString(err.Error()):
+		return reasonHeadModified
+	case isBaseModified(err):
+		return reasonBaseModified
+	case methodNotAllowedRegexp.MatchString(err.Error()):
+		return reasonMethodNotAllowed
+	}
+	return reasonUnknown
+}
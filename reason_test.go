@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_failureReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "classified where returned",
+			err:  fmt.Errorf("failed to merge: %w", withReason(reasonBlockedLabel, errors.New("merge is blocked by label WIP"))),
+			want: reasonBlockedLabel,
+		},
+		{
+			name: "rate limit",
+			err:  &github.RateLimitError{Message: "API rate limit exceeded"},
+			want: reasonRateLimited,
+		},
+		{
+			name: "abuse rate limit",
+			err:  &github.AbuseRateLimitError{Message: "You have triggered an abuse detection mechanism."},
+			want: reasonRateLimited,
+		},
+		{
+			name: "secondary rate limit",
+			err:  errorResponse(http.StatusForbidden, "You have exceeded a secondary rate limit."),
+			want: reasonRateLimited,
+		},
+		{
+			name: "unauthorized",
+			err:  &unauthorizedError{actor: "0daryo", mergers: []string{"na-ga"}},
+			want: reasonUnauthorized,
+		},
+		{
+			name: "checks pending",
+			err:  &pendingChecksError{names: []string{"test"}},
+			want: reasonChecksPending,
+		},
+		{
+			name: "checks failed",
+			err:  evaluateChecks([]string{"test"}, map[string]string{"test": checkFailure}),
+			want: reasonChecksFailed,
+		},
+		{
+			name: "approval required by github",
+			err:  errorResponse(http.StatusMethodNotAllowed, "At least 1 approving review is required by reviewers with write access."),
+			want: reasonApprovalsRequired,
+		},
+		{
+			name: "conflict",
+			err:  errorResponse(http.StatusMethodNotAllowed, "Pull Request is not mergeable"),
+			want: reasonConflict,
+		},
+		{
+			name: "head modified",
+			err:  errorResponse(http.StatusConflict, "Head branch was modified. Review and try the merge again."),
+			want: reasonHeadModified,
+		},
+		{
+			name: "base modified",
+			err:  errorResponse(http.StatusConflict, "Base branch was modified. Review and try the merge again."),
+			want: reasonBaseModified,
+		},
+		{
+			name: "merge method not allowed",
+			err:  errorResponse(http.StatusMethodNotAllowed, "Squash merges are not allowed on this repository."),
+			want: reasonMethodNotAllowed,
+		},
+		{
+			name: "unknown",
+			err:  errors.New("failed to get pull request"),
+			want: reasonUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failureReason(tt.err); got != tt.want {
+				t.Errorf("failureReason() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
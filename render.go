@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/go-github/github"
+)
+
+// fakePR describes a pull request to preview commit message templates without github.
+type fakePR struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	Labels []string `json:"labels"`
+	Author string   `json:"author"`
+}
+
+// pullRequest returns the pull request which templates are rendered with.
+func (f *fakePR) pullRequest() *github.PullRequest {
+	pr := &github.PullRequest{
+		Number: github.Int(f.Number),
+		Title:  github.String(f.Title),
+		Body:   github.String(f.Body),
+		User:   &github.User{Login: github.String(f.Author)},
+	}
+	for _, l := range f.Labels {
+		pr.Labels = append(pr.Labels, &github.Label{Name: github.String(l)})
+	}
+	return pr
+}
+
+// renderTemplates prints the commit subject and body rendered for the pull request described in the JSON file at path.
+// nothing is requested to github, so that templates can be previewed locally.
+func renderTemplates(w io.Writer, path string, e env) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pull request file: %w", err)
+	}
+	var f fakePR
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("failed to parse pull request file: %w", err)
+	}
+	tpls, err := loadTemplates(e)
+	if err != nil {
+		return err
+	}
+	pr := f.pullRequest()
+	subject, err := generateCommitSubject(pr, tpls)
+	if err != nil {
+		return fmt.Errorf("failed to generate subject: %w", err)
+	}
+	body, err := commitMessage(pr, nil, e, e.MergeMethod, tpls)
+	if err != nil {
+		return fmt.Errorf("failed to generate template: %w", err)
+	}
+	fmt.Fprintf(w, "%s\n\n%s\n", subject, body)
+	return nil
+}
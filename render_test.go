@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_renderTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		pr      string
+		e       env
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "built-in templates",
+			pr:   `{"number":1,"title":"pull request title","body":"pull request body","labels":["label1"],"author":"0daryo"}`,
+			e:    env{MergeMethod: "merge", ReleaseNote: true},
+			want: "pull request title (#1)\n\n\npull request body\n\nLabels:\n  * label1\n```release-note\n* NONE\n```\n",
+		},
+		{
+			name: "custom templates",
+			pr:   `{"number":1,"title":"pull request title","author":"0daryo"}`,
+			e: env{
+				MergeMethod:     "merge",
+				SubjectTemplate: "{{ .Title }} by {{ .Author }}",
+				BodyTemplate:    "Merged PR #{{ .Number }}",
+			},
+			want: "pull request title by 0daryo\n\nMerged PR #1\n",
+		},
+		{
+			name:    "invalid json",
+			pr:      `{"number":`,
+			e:       env{MergeMethod: "merge"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pr.json")
+			if err := os.WriteFile(path, []byte(tt.pr), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if err := renderTemplates(&out, path, tt.e); (err != nil) != tt.wantErr {
+				t.Fatalf("renderTemplates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if out.String() != tt.want {
+				t.Errorf("renderTemplates() printed %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
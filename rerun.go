@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// rerunConclusions are conclusions of check suites which are re-run. passing suites are never re-run.
+var rerunConclusions = map[string]bool{
+	"failure":   true,
+	"timed_out": true,
+	"cancelled": true,
+	"stale":     true,
+}
+
+// rerunChecks re-requests failed or stale check suites of the pull request head and waits for them to complete within timeout.
+// the re-run is reported by a progress comment.
+func (gh *ghClient) rerunChecks(ctx context.Context, e env, pr *github.PullRequest, timeout time.Duration) error {
+	owner, repo := e.Owner, e.Repo
+	suites, err := gh.rerunSuites(ctx, owner, repo, pr.GetHead().GetSHA())
+	if err != nil {
+		return err
+	}
+	if len(suites) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(suites))
+	for _, s := range suites {
+		if err := gh.rerequestCheckSuite(ctx, owner, repo, s.GetID()); err != nil {
+			return err
+		}
+		names = append(names, s.GetApp().GetName())
+	}
+	msg := fmt.Sprintf("Re-running %d check suites: %s", len(suites), strings.Join(names, ", "))
+	p := gh.startProgress(ctx, e, pr.GetNumber(), msg)
+	werr := gh.waitCheckSuites(ctx, owner, repo, suites, timeout)
+	if werr != nil {
+		msg += fmt.Sprintf("\n\nCheck suites did not complete: %v", werr)
+	} else {
+		msg += "\n\nCheck suites completed."
+	}
+	p.finish(ctx, msg, werr)
+	return werr
+}
+
+// rerunSuites returns completed check suites of ref whose conclusion is failed or stale.
+func (gh *ghClient) rerunSuites(ctx context.Context, owner, repo, ref string) ([]*github.CheckSuite, error) {
+	var suites []*github.CheckSuite
+	opt := &github.ListCheckSuiteOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		res, resp, err := gh.client.Checks.ListCheckSuitesForRef(ctx, owner, repo, ref, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list check suites: %w", err)
+		}
+		for _, s := range res.CheckSuites {
+			if s.GetStatus() == "completed" && rerunConclusions[s.GetConclusion()] {
+				suites = append(suites, s)
+			}
+		}
+		if resp.NextPage == 0 {
+			return suites, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// rerequestCheckSuite re-runs the check suite.
+// GitHub API docs: https://docs.github.com/en/rest/checks/suites#rerequest-a-check-suite
+func (gh *ghClient) rerequestCheckSuite(ctx context.Context, owner, repo string, id int64) error {
+	req, err := gh.client.NewRequest(http.MethodPost, fmt.Sprintf("repos/%s/%s/check-suites/%d/rerequest", owner, repo, id), nil)
+	if err != nil {
+		return err
+	}
+	if _, err := gh.client.Do(ctx, req, nil); err != nil {
+		return fmt.Errorf("failed to rerequest check suite: %w", err)
+	}
+	return nil
+}
+
+// waitCheckSuites polls check suites until all of them are completed.
+func (gh *ghClient) waitCheckSuites(ctx context.Context, owner, repo string, suites []*github.CheckSuite, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		pending := 0
+		for _, s := range suites {
+			latest, _, err := gh.client.Checks.GetCheckSuite(ctx, owner, repo, s.GetID())
+			if err != nil {
+				return fmt.Errorf("failed to get check suite: %w", err)
+			}
+			if latest.GetStatus() != "completed" {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d check suites are not completed within %s", pending, timeout)
+		case <-time.After(checksInterval):
+		}
+	}
+}
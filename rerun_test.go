@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func Test_ghClient_rerunChecks(t *testing.T) {
+	var rerequested []string
+	var comments []string
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/abema/github-actions-merger/commits/sha/check-suites":
+			w.Write([]byte(`{"total_count":3,"check_suites":[
+				{"id":1,"status":"completed","conclusion":"success","app":{"name":"ci"}},
+				{"id":2,"status":"completed","conclusion":"failure","app":{"name":"lint"}},
+				{"id":3,"status":"completed","conclusion":"stale","app":{"name":"e2e"}}
+			]}`))
+		case r.Method == http.MethodPost && (r.URL.Path == "/repos/abema/github-actions-merger/check-suites/2/rerequest" || r.URL.Path == "/repos/abema/github-actions-merger/check-suites/3/rerequest"):
+			rerequested = append(rerequested, r.URL.Path)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet && (r.URL.Path == "/repos/abema/github-actions-merger/check-suites/2" || r.URL.Path == "/repos/abema/github-actions-merger/check-suites/3"):
+			w.Write([]byte(`{"status":"completed","conclusion":"success"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/abema/github-actions-merger/issues/1/comments",
+			r.Method == http.MethodPatch && r.URL.Path == "/repos/abema/github-actions-merger/issues/comments/10":
+			var c github.IssueComment
+			json.NewDecoder(r.Body).Decode(&c)
+			comments = append(comments, c.GetBody())
+			w.Write([]byte(`{"id":10}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Head:   &github.PullRequestBranch{SHA: github.String("sha")},
+	}
+	if err := gh.rerunChecks(context.Background(), env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1}, pr, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(rerequested) != 2 {
+		t.Errorf("rerequested %v, want only failed and stale suites", rerequested)
+	}
+	want := []string{
+		"Re-running 2 check suites: lint, e2e",
+		"Re-running 2 check suites: lint, e2e\n\nCheck suites completed.",
+	}
+	if len(comments) != len(want) || comments[0] != want[0] || comments[1] != want[1] {
+		t.Errorf("comments = %q, want %q", comments, want)
+	}
+}
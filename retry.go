@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryTransport retries requests on transient failures of github api with exponential backoff.
+// network errors, 5xx, 429 and 403 abuse responses are retried. other 4xx are never retried.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	// baseDelay is the delay before the first retry, which is doubled on every retry.
+	baseDelay time.Duration
+}
+
+func newRetryTransport(base http.RoundTripper, maxRetries int) *retryTransport {
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		baseDelay:  time.Second,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+		resp, err := t.base.RoundTrip(r)
+		wait, retry := retryable(resp, err)
+		if !retry || attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if wait == 0 {
+			wait = t.baseDelay << attempt
+		}
+		// give up if the job deadline comes before the next attempt.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryable returns whether the response should be retried and how long to wait before retrying.
+// zero wait means the default backoff.
+func retryable(resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		// network error.
+		return 0, true
+	}
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return retryAfter, true
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "":
+		// abuse detection responses include Retry-After header.
+		return retryAfter, true
+	default:
+		return 0, false
+	}
+}
+
+// parseRetryAfter returns duration of Retry-After header in seconds.
+func parseRetryAfter(v string) time.Duration {
+	s, err := strconv.Atoi(v)
+	if err != nil || s < 0 {
+		return 0
+	}
+	return time.Duration(s) * time.Second
+}
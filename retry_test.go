@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_retryTransport_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		header       http.Header
+		maxRetries   int
+		wantStatus   int
+		wantAttempts int
+	}{
+		{
+			name:         "retry on 5xx",
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			maxRetries:   3,
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "give up after max retries",
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			maxRetries:   2,
+			wantStatus:   http.StatusBadGateway,
+			wantAttempts: 3,
+		},
+		{
+			name:         "retry on abuse response",
+			statuses:     []int{http.StatusForbidden, http.StatusOK},
+			header:       http.Header{"Retry-After": []string{"0"}},
+			maxRetries:   3,
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "no retry on 403 without Retry-After",
+			statuses:     []int{http.StatusForbidden, http.StatusOK},
+			maxRetries:   3,
+			wantStatus:   http.StatusForbidden,
+			wantAttempts: 1,
+		},
+		{
+			name:         "no retry on 404",
+			statuses:     []int{http.StatusNotFound, http.StatusOK},
+			maxRetries:   3,
+			wantStatus:   http.StatusNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:         "no retry on 422",
+			statuses:     []int{http.StatusUnprocessableEntity, http.StatusOK},
+			maxRetries:   3,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if b, _ := io.ReadAll(r.Body); string(b) != "body" {
+					t.Errorf("request body = %q, want %q", b, "body")
+				}
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer srv.Close()
+			c := &http.Client{Transport: &retryTransport{
+				base:       http.DefaultTransport,
+				maxRetries: tt.maxRetries,
+				baseDelay:  time.Millisecond,
+			}}
+			req, err := http.NewRequest(http.MethodPut, srv.URL, bytes.NewBufferString("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("RoundTrip() status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("RoundTrip() attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func Test_retryTransport_RoundTrip_deadline(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c := &http.Client{Transport: &retryTransport{
+		base:       http.DefaultTransport,
+		maxRetries: 3,
+		baseDelay:  time.Minute,
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if attempts != 1 {
+		t.Errorf("RoundTrip() attempts = %v, want 1 since backoff exceeds the deadline", attempts)
+	}
+}
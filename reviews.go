@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// checkApprovals returns error if the pull request has less approvals than minApprovals.
+func (gh *ghClient) checkApprovals(ctx context.Context, owner, repo string, pr *github.PullRequest, minApprovals int) error {
+	reviews, err := gh.listReviews(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return err
+	}
+	if n := countApprovals(reviews, pr.GetHead().GetSHA()); n < minApprovals {
+		return withReason(reasonApprovalsRequired, fmt.Errorf("need %d approvals, have %d", minApprovals, n))
+	}
+	return nil
+}
+
+// checkCodeOwners returns error listing code owners who still need to approve the pull request.
+// code owners are owners in CODEOWNERS of changed files. github requests their reviews automatically
+// and removes the request once they review, so pending requests of code owners are outstanding approvals.
+func (gh *ghClient) checkCodeOwners(ctx context.Context, owner, repo string, pr *github.PullRequest) error {
+	owners, err := gh.codeOwners(ctx, owner, repo, pr)
+	if err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+	requested, _, err := gh.client.PullRequests.ListReviewers(ctx, owner, repo, pr.GetNumber(), &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return fmt.Errorf("failed to list requested reviewers: %w", err)
+	}
+	reviews, err := gh.listReviews(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return err
+	}
+	pending, err := gh.pendingCodeOwners(ctx, owner, requested, reviews, owners)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return withReason(reasonCodeOwnersRequired, fmt.Errorf("code owners still need to approve: %s", strings.Join(pending, ", ")))
+	}
+	return nil
+}
+
+// pendingCodeOwners returns requested users and teams among owners, and code owners whose latest review requests changes.
+// requested teams are of org, which owns the repository.
+func (gh *ghClient) pendingCodeOwners(ctx context.Context, org string, requested *github.Reviewers, reviews []*github.PullRequestReview, owners map[string]bool) ([]string, error) {
+	var pending []string
+	for _, u := range requested.Users {
+		if owners["@"+strings.ToLower(u.GetLogin())] {
+			pending = append(pending, "@"+u.GetLogin())
+		}
+	}
+	for _, t := range requested.Teams {
+		if owners["@"+strings.ToLower(org+"/"+t.GetSlug())] {
+			// teams are not mentioned to avoid notifying every member.
+			pending = append(pending, fmt.Sprintf("team `%s`", t.GetSlug()))
+		}
+	}
+	var changes []string
+	for login, r := range latestReviews(reviews) {
+		if r.GetState() != "CHANGES_REQUESTED" {
+			continue
+		}
+		owner, err := gh.isCodeOwner(ctx, org, login, owners)
+		if err != nil {
+			return nil, err
+		}
+		if owner {
+			changes = append(changes, fmt.Sprintf("@%s (changes requested)", login))
+		}
+	}
+	sort.Strings(changes)
+	return append(pending, changes...), nil
+}
+
+// autoApprove approves the pull request on behalf of actor, and returns whether an approval was added.
+// the pull request is not approved if actor already approved it or actor is the author, since github forbids self-approval.
+func (gh *ghClient) autoApprove(ctx context.Context, owner, repo string, pr *github.PullRequest, actor string) (bool, error) {
+	if actor == pr.GetUser().GetLogin() {
+		return false, nil
+	}
+	reviews, err := gh.listReviews(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return false, err
+	}
+	if hasApproved(reviews, actor, pr.GetHead().GetSHA()) {
+		return false, nil
+	}
+	_, _, err = gh.client.PullRequests.CreateReview(ctx, owner, repo, pr.GetNumber(), &github.PullRequestReviewRequest{
+		CommitID: github.String(pr.GetHead().GetSHA()),
+		Body:     github.String(fmt.Sprintf("Approved on behalf of @%s.", actor)),
+		Event:    github.String("APPROVE"),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to approve pull request: %w", err)
+	}
+	return true, nil
+}
+
+// listReviews returns every review of the pull request following pagination.
+func (gh *ghClient) listReviews(ctx context.Context, owner, repo string, prNumber int) ([]*github.PullRequestReview, error) {
+	var reviews []*github.PullRequestReview
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		rs, resp, err := gh.client.PullRequests.ListReviews(ctx, owner, repo, prNumber, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list reviews: %w", err)
+		}
+		reviews = append(reviews, rs...)
+		if resp.NextPage == 0 {
+			return reviews, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// countApprovals returns the number of distinct reviewers whose latest review approves headSHA.
+// dismissed reviews and stale reviews for older commits are not counted.
+func countApprovals(reviews []*github.PullRequestReview, headSHA string) int {
+	n := 0
+	for _, r := range latestReviews(reviews) {
+		if r.GetState() == "APPROVED" && r.GetCommitID() == headSHA {
+			n++
+		}
+	}
+	return n
+}
+
+// hasApproved returns whether the latest review of user approves headSHA.
+func hasApproved(reviews []*github.PullRequestReview, user, headSHA string) bool {
+	r, ok := latestReviews(reviews)[user]
+	return ok && r.GetState() == "APPROVED" && r.GetCommitID() == headSHA
+}
+
+// latestReviews returns the latest review of each reviewer keyed by login.
+func latestReviews(reviews []*github.PullRequestReview) map[string]*github.PullRequestReview {
+	// reviews are listed in chronological order.
+	latest := map[string]*github.PullRequestReview{}
+	for _, r := range reviews {
+		if r.GetState() == "COMMENTED" {
+			// comments do not change approval state of the reviewer.
+			continue
+		}
+		latest[r.GetUser().GetLogin()] = r
+	}
+	return latest
+}
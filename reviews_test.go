@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func review(login, state, commitID string) *github.PullRequestReview {
+	return &github.PullRequestReview{
+		User:     &github.User{Login: github.String(login)},
+		State:    github.String(state),
+		CommitID: github.String(commitID),
+	}
+}
+
+func Test_countApprovals(t *testing.T) {
+	type args struct {
+		reviews []*github.PullRequestReview
+		headSHA string
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{
+			name: "distinct approvers",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("0daryo", "APPROVED", "sha"),
+					review("0daryo", "APPROVED", "sha"),
+					review("na-ga", "APPROVED", "sha"),
+				},
+				headSHA: "sha",
+			},
+			want: 2,
+		},
+		{
+			name: "comment after approval keeps approval",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("0daryo", "APPROVED", "sha"),
+					review("0daryo", "COMMENTED", "sha"),
+				},
+				headSHA: "sha",
+			},
+			want: 1,
+		},
+		{
+			name: "dismissed and changes requested are not counted",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("0daryo", "APPROVED", "sha"),
+					review("0daryo", "DISMISSED", "sha"),
+					review("na-ga", "APPROVED", "sha"),
+					review("na-ga", "CHANGES_REQUESTED", "sha"),
+				},
+				headSHA: "sha",
+			},
+			want: 0,
+		},
+		{
+			name: "stale approval is not counted",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("0daryo", "APPROVED", "old"),
+				},
+				headSHA: "sha",
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countApprovals(tt.args.reviews, tt.args.headSHA); got != tt.want {
+				t.Errorf("countApprovals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hasApproved(t *testing.T) {
+	type args struct {
+		reviews []*github.PullRequestReview
+		user    string
+		headSHA string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "approved",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("0daryo", "APPROVED", "sha"),
+					review("na-ga", "CHANGES_REQUESTED", "sha"),
+				},
+				user:    "0daryo",
+				headSHA: "sha",
+			},
+			want: true,
+		},
+		{
+			name: "approval of other reviewer",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("na-ga", "APPROVED", "sha"),
+				},
+				user:    "0daryo",
+				headSHA: "sha",
+			},
+		},
+		{
+			name: "stale approval",
+			args: args{
+				reviews: []*github.PullRequestReview{
+					review("0daryo", "APPROVED", "old"),
+				},
+				user:    "0daryo",
+				headSHA: "sha",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasApproved(tt.args.reviews, tt.args.user, tt.args.headSHA); got != tt.want {
+				t.Errorf("hasApproved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ghClient_checkApprovals_pagination(t *testing.T) {
+	pages := map[string]string{
+		"":  `[{"user":{"login":"alice"},"state":"APPROVED","commit_id":"head"},{"user":{"login":"bob"},"state":"COMMENTED","commit_id":"head"}]`,
+		"2": `[{"user":{"login":"carol"},"state":"APPROVED","commit_id":"head"}]`,
+	}
+	gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+		}
+		w.Write([]byte(pages[page]))
+	}))
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Head:   &github.PullRequestBranch{SHA: github.String("head")},
+	}
+	reviews, err := gh.listReviews(context.Background(), "abema", "github-actions-merger", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 3 {
+		t.Errorf("ghClient.listReviews() returned %d reviews, want 3", len(reviews))
+	}
+	if err := gh.checkApprovals(context.Background(), "abema", "github-actions-merger", pr, 2); err != nil {
+		t.Errorf("ghClient.checkApprovals() error = %v, want approvals of both pages counted", err)
+	}
+}
+
+func Test_ghClient_checkCodeOwners(t *testing.T) {
+	codeOwners := `{"type":"file","encoding":"base64","content":"` + base64.StdEncoding.EncodeToString([]byte("# owners\n*.go @alice @abema/core-reviewers\n/docs/ @carol\n")) + `"}`
+	tests := []struct {
+		name       string
+		codeOwners string
+		files      string
+		requested  string
+		reviews    string
+		members    map[string]bool
+		wantErr    string
+	}{
+		{
+			name:       "code owners approved",
+			codeOwners: codeOwners,
+			files:      `[{"filename":"main.go"}]`,
+			requested:  `{"users":[],"teams":[]}`,
+			reviews:    `[{"user":{"login":"alice"},"state":"APPROVED","commit_id":"head"}]`,
+		},
+		{
+			name:       "pending users and teams",
+			codeOwners: codeOwners,
+			files:      `[{"filename":"main.go"}]`,
+			requested:  `{"users":[{"login":"alice"}],"teams":[{"slug":"core-reviewers"}]}`,
+			reviews:    `[]`,
+			wantErr:    "code owners still need to approve: @alice, team `core-reviewers`",
+		},
+		{
+			name:       "pending reviewers other than code owners",
+			codeOwners: codeOwners,
+			files:      `[{"filename":"main.go"}]`,
+			requested:  `{"users":[{"login":"dave"}],"teams":[{"slug":"qa"}]}`,
+			reviews:    `[]`,
+		},
+		{
+			name:       "pending code owners of files not changed",
+			codeOwners: codeOwners,
+			files:      `[{"filename":"main.go"}]`,
+			requested:  `{"users":[{"login":"carol"}],"teams":[]}`,
+			reviews:    `[]`,
+		},
+		{
+			name:       "changes requested",
+			codeOwners: codeOwners,
+			files:      `[{"filename":"docs/usage.md"},{"filename":"main.go"}]`,
+			requested:  `{"users":[],"teams":[]}`,
+			reviews:    `[{"user":{"login":"carol"},"state":"CHANGES_REQUESTED","commit_id":"head"},{"user":{"login":"bob"},"state":"CHANGES_REQUESTED","commit_id":"head"},{"user":{"login":"bob"},"state":"APPROVED","commit_id":"head"},{"user":{"login":"erin"},"state":"CHANGES_REQUESTED","commit_id":"head"},{"user":{"login":"dave"},"state":"CHANGES_REQUESTED","commit_id":"head"}]`,
+			members:    map[string]bool{"erin": true},
+			wantErr:    "code owners still need to approve: @carol (changes requested), @erin (changes requested)",
+		},
+		{
+			name:      "no CODEOWNERS",
+			requested: `{"users":[{"login":"alice"}],"teams":[]}`,
+			reviews:   `[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasPrefix(r.URL.Path, "/repos/abema/github-actions-merger/contents/"):
+					if r.URL.Path != "/repos/abema/github-actions-merger/contents/.github/CODEOWNERS" || tt.codeOwners == "" {
+						w.WriteHeader(http.StatusNotFound)
+						w.Write([]byte(`{"message":"Not Found"}`))
+						return
+					}
+					if ref := r.URL.Query().Get("ref"); ref != "main" {
+						t.Errorf("CODEOWNERS read from %s, want main", ref)
+					}
+					w.Write([]byte(tt.codeOwners))
+				case r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/files":
+					w.Write([]byte(tt.files))
+				case r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/requested_reviewers":
+					w.Write([]byte(tt.requested))
+				case r.URL.Path == "/repos/abema/github-actions-merger/pulls/1/reviews":
+					w.Write([]byte(tt.reviews))
+				case strings.HasPrefix(r.URL.Path, "/orgs/abema/teams/core-reviewers/memberships/"):
+					if !tt.members[path.Base(r.URL.Path)] {
+						w.WriteHeader(http.StatusNotFound)
+						w.Write([]byte(`{"message":"Not Found"}`))
+						return
+					}
+					w.Write([]byte(`{"state":"active"}`))
+				default:
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+			}))
+			pr := &github.PullRequest{
+				Number: github.Int(1),
+				Base:   &github.PullRequestBranch{Ref: github.String("main")},
+			}
+			err := gh.checkCodeOwners(context.Background(), "abema", "github-actions-merger", pr)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ghClient.checkCodeOwners() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ghClient.checkCodeOwners() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// selfTest validates the token and access to the repository, and prints resolved config to out without merging.
+func (gh *ghClient) selfTest(ctx context.Context, e env, out io.Writer) error {
+	if e.AppID != 0 {
+		// installation tokens cannot get the authenticated user, and minting one already validated the credentials.
+		fmt.Fprintf(out, "authenticated as installation %d of app %d\n", e.InstallationID, e.AppID)
+	} else {
+		user, _, err := gh.client.Users.Get(ctx, "")
+		if err != nil {
+			return fmt.Errorf("token is invalid: %w", err)
+		}
+		fmt.Fprintf(out, "authenticated as %s\n", user.GetLogin())
+	}
+	repo, _, err := gh.client.Repositories.Get(ctx, e.Owner, e.Repo)
+	if err != nil {
+		return fmt.Errorf("token cannot access %s/%s: %w", e.Owner, e.Repo, err)
+	}
+	fmt.Fprintf(out, "repository %s is accessible, permissions: %s\n", repo.GetFullName(), formatPermissions(repo.Permissions))
+	fmt.Fprintln(out, "config:")
+	for _, kv := range configValues(e) {
+		fmt.Fprintf(out, "  %s\n", kv)
+	}
+	return nil
+}
+
+// formatPermissions returns granted permissions in a stable order.
+func formatPermissions(p *map[string]bool) string {
+	if p == nil {
+		return "unknown"
+	}
+	var granted []string
+	for _, name := range []string{"admin", "maintain", "push", "triage", "pull"} {
+		if (*p)[name] {
+			granted = append(granted, name)
+		}
+	}
+	if len(granted) == 0 {
+		return "none"
+	}
+	return strings.Join(granted, ", ")
+}
+
+// configValues returns NAME=value of env fields in the order of declaration. secrets are masked.
+func configValues(e env) []string {
+	v, t := reflect.ValueOf(e), reflect.TypeOf(e)
+	values := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("envconfig")
+		value := fmt.Sprint(v.Field(i).Interface())
+		// slack webhook urls embed the credential.
+		if (strings.Contains(name, "TOKEN") || strings.Contains(name, "SECRET") || name == "SLACK_WEBHOOK_URL" || name == "PRIVATE_KEY") && value != "" {
+			value = "***"
+		}
+		values = append(values, fmt.Sprintf("%s=%s", name, value))
+	}
+	return values
+}
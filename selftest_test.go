@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_ghClient_selfTest(t *testing.T) {
+	tests := []struct {
+		name       string
+		userStatus int
+		repoStatus int
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "valid token",
+			userStatus: http.StatusOK,
+			repoStatus: http.StatusOK,
+			want: []string{
+				"authenticated as merger-bot\n",
+				"repository abema/github-actions-merger is accessible, permissions: push, pull\n",
+				"  GITHUB_TOKEN=***\n",
+				"  MERGE_METHOD=squash\n",
+				"  SLACK_WEBHOOK_URL=***\n",
+			},
+		},
+		{
+			name:       "invalid token",
+			userStatus: http.StatusUnauthorized,
+			wantErr:    true,
+		},
+		{
+			name:       "no access to the repository",
+			userStatus: http.StatusOK,
+			repoStatus: http.StatusNotFound,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newTestGHClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/user":
+					w.WriteHeader(tt.userStatus)
+					w.Write([]byte(`{"login":"merger-bot"}`))
+				case "/repos/abema/github-actions-merger":
+					w.WriteHeader(tt.repoStatus)
+					w.Write([]byte(`{"full_name":"abema/github-actions-merger","permissions":{"admin":false,"push":true,"pull":true}}`))
+				default:
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+			}))
+			out := new(strings.Builder)
+			e := env{GithubToken: "token", Owner: "abema", Repo: "github-actions-merger", MergeMethod: "squash", SlackWebhookURL: "https://hooks.slack.com/services/T/B/secret"}
+			err := gh.selfTest(context.Background(), e, out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ghClient.selfTest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("ghClient.selfTest() output does not include %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// slackPayload is a message of slack incoming webhooks.
+// Slack docs: https://api.slack.com/messaging/webhooks
+type slackPayload struct {
+	// Text is the fallback of blocks shown in notifications.
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackFailurePayload returns the slack message of the failure of the pull request.
+func slackFailurePayload(e env, msg string, err error) slackPayload {
+	pr := fmt.Sprintf("%s/%s#%d", e.Owner, e.Repo, e.PRNumber)
+	link := fmt.Sprintf("<https://github.com/%s/%s/pull/%d|%s>", e.Owner, e.Repo, e.PRNumber, pr)
+	return slackPayload{
+		Text: fmt.Sprintf("%s: %s", pr, msg),
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf("%s: *%s*", link, msg)}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf("*Actor:* %s\n*Error:*\n```%s```", e.Actor, err.Error())}},
+		},
+	}
+}
+
+// notifySlack posts the payload to the slack incoming webhook url.
+func notifySlack(url string, p slackPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack payload: %w", err)
+	}
+	if err := postJSON(url, body, nil); err != nil {
+		return fmt.Errorf("failed to post slack message: %w", err)
+	}
+	return nil
+}
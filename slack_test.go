@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_slackFailurePayload(t *testing.T) {
+	e := env{Owner: "abema", Repo: "github-actions-merger", PRNumber: 1, Actor: "0daryo"}
+	got := slackFailurePayload(e, "failed to merge", errors.New("need 1 approvals, have 0"))
+	want := slackPayload{
+		Text: "abema/github-actions-merger#1: failed to merge",
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "<https://github.com/abema/github-actions-merger/pull/1|abema/github-actions-merger#1>: *failed to merge*"}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*Actor:* 0daryo\n*Error:*\n```need 1 approvals, have 0```"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("slackFailurePayload() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_notifySlack(t *testing.T) {
+	payload := slackPayload{Text: "text", Blocks: []slackBlock{{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "text"}}}}
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{
+			name:   "posted",
+			status: http.StatusOK,
+		},
+		{
+			name:    "slack is down",
+			status:  http.StatusServiceUnavailable,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var got slackPayload
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode payload: %v", err)
+				}
+				if !reflect.DeepEqual(got, payload) {
+					t.Errorf("payload = %+v, want %+v", got, payload)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			if err := notifySlack(srv.URL, payload); (err != nil) != tt.wantErr {
+				t.Errorf("notifySlack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// embed tz database since the runtime image does not include it.
+	_ "time/tzdata"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// mergeWindow is a weekly time window when pull requests are allowed to be merged.
+// format is `[days ]HH:MM-HH:MM[ timezone]` .e.g. `Mon-Fri 09:00-17:00 UTC`, where days are a range or comma separated weekdays.
+// every day is allowed if days are omitted, and timezone defaults to UTC.
+type mergeWindow struct {
+	// value is the window as specified.
+	value   string
+	enabled bool
+	days    [7]bool
+	// start and end are minutes from midnight. the window is [start, end).
+	start, end int
+	loc        *time.Location
+}
+
+// Decode implements envconfig.Decoder.
+func (w *mergeWindow) Decode(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		*w = mergeWindow{}
+		return nil
+	}
+	mw := mergeWindow{value: value, enabled: true, loc: time.UTC}
+	i := 0
+	if !strings.Contains(fields[0], ":") {
+		if err := mw.parseDays(fields[0]); err != nil {
+			return err
+		}
+		i++
+	} else {
+		for d := range mw.days {
+			mw.days[d] = true
+		}
+	}
+	if i >= len(fields) {
+		return fmt.Errorf("invalid merge window %q, time range is required", value)
+	}
+	start, end, ok := strings.Cut(fields[i], "-")
+	if !ok {
+		return fmt.Errorf("invalid merge window %q, time range must be HH:MM-HH:MM", value)
+	}
+	var err error
+	if mw.start, err = parseClock(start); err != nil {
+		return err
+	}
+	if mw.end, err = parseClock(end); err != nil {
+		return err
+	}
+	if mw.start >= mw.end {
+		return fmt.Errorf("invalid merge window %q, start must be before end", value)
+	}
+	i++
+	if i < len(fields) {
+		if mw.loc, err = time.LoadLocation(fields[i]); err != nil {
+			return fmt.Errorf("invalid merge window %q: %w", value, err)
+		}
+		i++
+	}
+	if i < len(fields) {
+		return fmt.Errorf("invalid merge window %q, format must be [days ]HH:MM-HH:MM[ timezone]", value)
+	}
+	*w = mw
+	return nil
+}
+
+// parseDays parses a range of weekdays .e.g. Mon-Fri, or comma separated weekdays .e.g. Mon,Wed,Fri.
+func (w *mergeWindow) parseDays(s string) error {
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		f, fok := weekdays[strings.ToLower(from)]
+		t, tok := weekdays[strings.ToLower(to)]
+		if !fok || !tok {
+			return fmt.Errorf("invalid weekdays %q", s)
+		}
+		for d := f; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == t {
+				return nil
+			}
+		}
+	}
+	for _, day := range strings.Split(s, ",") {
+		d, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("invalid weekday %q", day)
+		}
+		w.days[d] = true
+	}
+	return nil
+}
+
+// parseClock returns minutes from midnight of HH:MM.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, format must be HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+func (w mergeWindow) String() string {
+	return w.value
+}
+
+// contains returns whether t is in the window. every time is in the window if it is not enabled.
+func (w mergeWindow) contains(t time.Time) bool {
+	if !w.enabled {
+		return true
+	}
+	t = t.In(w.loc)
+	minutes := t.Hour()*60 + t.Minute()
+	return w.days[t.Weekday()] && w.start <= minutes && minutes < w.end
+}
+
+// next returns the start of the window next to t. t is returned if it is in the window.
+func (w mergeWindow) next(t time.Time) time.Time {
+	if w.contains(t) {
+		return t
+	}
+	t = t.In(w.loc)
+	// the window starts at least once a week, since some day is always allowed.
+	for d := 0; d <= 7; d++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+d, w.start/60, w.start%60, 0, 0, w.loc)
+		if w.days[start.Weekday()] && start.After(t) {
+			return start
+		}
+	}
+	return t
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_mergeWindow(t *testing.T) {
+	// 2023-01-02 is Monday.
+	monday := func(hour, min int) time.Time { return time.Date(2023, 1, 2, hour, min, 0, 0, time.UTC) }
+	tests := []struct {
+		name    string
+		value   string
+		t       time.Time
+		want    bool
+		wantErr bool
+	}{
+		{name: "inside weekdays", value: "Mon-Fri 09:00-17:00", t: monday(9, 0), want: true},
+		{name: "end is exclusive", value: "Mon-Fri 09:00-17:00", t: monday(17, 0)},
+		{name: "weekend", value: "Mon-Fri 09:00-17:00", t: monday(10, 0).AddDate(0, 0, 5)},
+		{name: "wrapping days", value: "Sat-Mon 09:00-17:00", t: monday(10, 0), want: true},
+		{name: "comma separated days", value: "Tue,Thu 09:00-17:00", t: monday(10, 0)},
+		{name: "every day", value: "00:00-24:00", t: monday(23, 59), want: true},
+		{name: "timezone", value: "Mon-Fri 09:00-17:00 Asia/Tokyo", t: monday(0, 30), want: true},
+		{name: "disabled", value: "", t: monday(3, 0), want: true},
+		{name: "invalid day", value: "Mon-Fry 09:00-17:00", wantErr: true},
+		{name: "invalid time", value: "Mon-Fri 9am-5pm", wantErr: true},
+		{name: "start after end", value: "17:00-09:00", wantErr: true},
+		{name: "invalid timezone", value: "09:00-17:00 Mars/Olympus", wantErr: true},
+		{name: "missing time range", value: "Mon-Fri", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w mergeWindow
+			err := w.Decode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mergeWindow.Decode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := w.contains(tt.t); got != tt.want {
+				t.Errorf("mergeWindow.contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeWindow_next(t *testing.T) {
+	// 2023-01-02 is Monday.
+	monday := func(hour, min int) time.Time { return time.Date(2023, 1, 2, hour, min, 0, 0, time.UTC) }
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		value string
+		t     time.Time
+		want  time.Time
+	}{
+		{name: "inside", value: "Mon-Fri 09:00-17:00", t: monday(10, 0), want: monday(10, 0)},
+		{name: "before start", value: "Mon-Fri 09:00-17:00", t: monday(8, 0), want: monday(9, 0)},
+		{name: "after end", value: "Mon-Fri 09:00-17:00", t: monday(17, 0), want: monday(9, 0).AddDate(0, 0, 1)},
+		{name: "weekend", value: "Mon-Fri 09:00-17:00", t: monday(10, 0).AddDate(0, 0, 5), want: monday(9, 0).AddDate(0, 0, 7)},
+		{name: "once a week", value: "Mon 09:00-17:00", t: monday(18, 0), want: monday(9, 0).AddDate(0, 0, 7)},
+		{name: "timezone", value: "Mon-Fri 09:00-17:00 Asia/Tokyo", t: monday(9, 0), want: time.Date(2023, 1, 3, 9, 0, 0, 0, tokyo)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w mergeWindow
+			if err := w.Decode(tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.next(tt.t); !got.Equal(tt.want) {
+				t.Errorf("mergeWindow.next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}